@@ -3,14 +3,15 @@ module github.com/VedRatan/k8s-agent
 go 1.24.0
 
 require (
+	github.com/VedRatan/k8swatchdog v0.0.0-20250317153151-31638c847f5d
 	github.com/gorilla/mux v1.8.1
 	github.com/stretchr/testify v1.10.0
 	go.uber.org/zap v1.27.0
 	k8s.io/api v0.32.2
 	k8s.io/apimachinery v0.32.2
 	k8s.io/client-go v0.32.2
-	github.com/VedRatan/k8swatchdog v0.0.0-20250317153151-31638c847f5d
 )
+
 replace github.com/VedRatan/k8swatchdog => ../
 
 require github.com/rogpeppe/go-internal v1.13.1 // indirect
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// The reasons of the events emitted on the objects changed by the agent
+const (
+	ReasonApplied        = "RemediationApplied"
+	ReasonApplyFailed    = "RemediationApplyFailed"
+	ReasonRolledBack     = "RemediationRolledBack"
+	ReasonRollbackFailed = "RemediationRollbackFailed"
+)
+
+// ActionRollback is passed in the action query parameter of the apply and patch requests which restore the
+// original object, it only changes the events emitted
+const ActionRollback = "rollback"
+
+var recorder record.EventRecorder
+
+func newRecorder(clientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "k8s-agent"})
+}
+
+// recordChange emits the event reporting the outcome of the change of obj requested by r, a remediation or a
+// rollback depending on the action query parameter
+func recordChange(r *http.Request, obj runtime.Object, err error) {
+	rollback := r.URL.Query().Get("action") == ActionRollback
+	switch {
+	case err == nil && rollback:
+		recorder.Event(obj, corev1.EventTypeNormal, ReasonRolledBack, "K8sWatchDog restored the original object")
+	case err == nil:
+		recorder.Event(obj, corev1.EventTypeNormal, ReasonApplied, "K8sWatchDog applied the remediation")
+	case rollback:
+		recorder.Eventf(obj, corev1.EventTypeWarning, ReasonRollbackFailed, "K8sWatchDog failed to restore the original object: %v", err)
+	default:
+		recorder.Eventf(obj, corev1.EventTypeWarning, ReasonApplyFailed, "K8sWatchDog failed to apply the remediation: %v", err)
+	}
+}
@@ -8,13 +8,18 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	customlogger "github.com/VedRatan/k8swatchdog/logger"
+	"github.com/VedRatan/k8swatchdog/sanitize"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
@@ -49,6 +54,7 @@ func init() { //nolint:gochecknoinits
 	if err != nil {
 		log.Fatalf("Error creating clientset: %v", err)
 	}
+	recorder = newRecorder(clientset)
 
 	// setup a custom logger which will be associated with the name as k8s-agent
 	logger, err = customlogger.NewLogger("k8s-agent")
@@ -67,13 +73,15 @@ func ApplyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// read the YAML payload and convert into pod manifest
-	var podManifest corev1.Pod
-	err = yaml.Unmarshal(manifest, &podManifest)
+	var decoded corev1.Pod
+	err = yaml.Unmarshal(manifest, &decoded)
 	if err != nil {
 		logger.Error("Error occurred", zap.Error(err))
 		http.Error(w, "Failed to decode YAML manifest into Pod", http.StatusBadRequest)
 		return
 	}
+	// drop the server-managed fields copied from the live pod, the api server refuses to create objects carrying them
+	podManifest := *sanitize.Pod(&decoded)
 
 	// fallback to default namespace if the namespace is not provided
 	namespace := podManifest.Namespace
@@ -116,12 +124,15 @@ func ApplyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// apply the manifest received from the payload, assuming that it is a remediated manifest
-	_, err = clientset.CoreV1().Pods(namespace).Create(context.Background(), &podManifest, v1.CreateOptions{})
+	created, err := clientset.CoreV1().Pods(namespace).Create(context.Background(), &podManifest, v1.CreateOptions{})
 	if err != nil {
+		podManifest.Namespace = namespace
+		recordChange(r, &podManifest, err)
 		logger.Error("failed to apply manifest", zap.Error(err))
 		http.Error(w, fmt.Sprintf("Failed to apply manifest: %v", err), http.StatusInternalServerError)
 		return
 	}
+	recordChange(r, created, nil)
 	logger.Info("remediated pod has been created", zap.String("name", namespace+"/"+name))
 
 	w.Header().Set("Content-Type", "application/json")
@@ -134,6 +145,50 @@ func ApplyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ValidateHandler runs a server-side dry-run create of the pod manifest, so that the remediation-server can
+// find out whether the manifest would be admitted before the faulty pod gets deleted. The dry-run pod is
+// returned, with the defaults and mutations of the api server applied.
+func ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	manifest, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var decoded corev1.Pod
+	err = yaml.Unmarshal(manifest, &decoded)
+	if err != nil {
+		logger.Error("Error occurred", zap.Error(err))
+		http.Error(w, "Failed to decode YAML manifest into Pod", http.StatusBadRequest)
+		return
+	}
+	podManifest := sanitize.Pod(&decoded)
+
+	namespace := podManifest.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	// the faulty pod still exists, so the dry-run uses a generated name to not collide with it
+	podManifest.GenerateName = podManifest.Name + "-"
+	podManifest.Name = ""
+
+	created, err := clientset.CoreV1().Pods(namespace).Create(r.Context(), podManifest, v1.CreateOptions{DryRun: []string{v1.DryRunAll}})
+	if err != nil {
+		logger.Info("manifest rejected by dry-run", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(created)
+	if err != nil {
+		logger.Error(LOG_ERROR_RESPONSE, zap.Error(err))
+		http.Error(w, fmt.Sprintf(ERROR_RESPONSE, err), http.StatusInternalServerError)
+		return
+	}
+}
+
 func ListPodsHandler(w http.ResponseWriter, r *http.Request) {
 	namespace := r.URL.Query().Get("namespace")
 	if namespace == "" {
@@ -160,7 +215,21 @@ func StreamLogsHandler(w http.ResponseWriter, r *http.Request) {
 	namespace := vars["namespace"]
 	podName := vars["podName"]
 
-	logs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{}).Stream(context.TODO())
+	// optional query parameters to select the container, the logs of its previous instance and the trailing lines
+	logOptions := &corev1.PodLogOptions{
+		Container: r.URL.Query().Get("container"),
+		Previous:  r.URL.Query().Get("previous") == "true",
+	}
+	if tail := r.URL.Query().Get("tailLines"); tail != "" {
+		tailLines, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid tailLines: %v", err), http.StatusBadRequest)
+			return
+		}
+		logOptions.TailLines = &tailLines
+	}
+
+	logs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, logOptions).Stream(context.TODO())
 	if err != nil {
 		logger.Error("failed to get logs", zap.Error(err))
 		http.Error(w, fmt.Sprintf("Failed to stream logs: %v", err), http.StatusInternalServerError)
@@ -212,3 +281,70 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// PatchWorkloadHandler applies a targeted patch to a Deployment, a StatefulSet or a DaemonSet. The patch type is
+// taken from the Content-Type, application/merge-patch+json or application/json-patch+json.
+func PatchWorkloadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	namespace := vars["namespace"]
+	name := vars["name"]
+
+	var patchType types.PatchType
+	switch r.Header.Get("Content-Type") {
+	case string(types.MergePatchType):
+		patchType = types.MergePatchType
+	case string(types.JSONPatchType):
+		patchType = types.JSONPatchType
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported patch type %s", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	opts := v1.PatchOptions{FieldManager: "k8s-agent"}
+	var patched runtime.Object
+	var kind string
+	switch strings.ToLower(vars["kind"]) {
+	case "deployment", "deployments":
+		kind = "Deployment"
+		patched, err = clientset.AppsV1().Deployments(namespace).Patch(r.Context(), name, patchType, patch, opts)
+	case "statefulset", "statefulsets":
+		kind = "StatefulSet"
+		patched, err = clientset.AppsV1().StatefulSets(namespace).Patch(r.Context(), name, patchType, patch, opts)
+	case "daemonset", "daemonsets":
+		kind = "DaemonSet"
+		patched, err = clientset.AppsV1().DaemonSets(namespace).Patch(r.Context(), name, patchType, patch, opts)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported workload kind %s", vars["kind"]), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			recordChange(r, &corev1.ObjectReference{Kind: kind, APIVersion: "apps/v1", Namespace: namespace, Name: name}, err)
+		}
+		logger.Error("failed to patch workload", zap.Error(err), zap.String("kind", vars["kind"]), zap.String("name", namespace+"/"+name))
+		status := http.StatusInternalServerError
+		if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			status = http.StatusUnprocessableEntity
+		} else if apierrors.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	recordChange(r, patched, nil)
+	logger.Info("patched workload", zap.String("kind", vars["kind"]), zap.String("name", namespace+"/"+name))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(patched)
+	if err != nil {
+		logger.Error(LOG_ERROR_RESPONSE, zap.Error(err))
+		http.Error(w, fmt.Sprintf(ERROR_RESPONSE, err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 func TestAll(t *testing.T) {
 	// Run tests in sequence
+	t.Run("TestValidateHandler", testValidateHandler)
 	t.Run("TestApplyHandler", testApplyHandler)
 	t.Run("TestListPodsHandler", testListPodsHandler)
 	t.Run("TestStreamLogsHandler", testStreamLogsHandler)
@@ -43,6 +44,39 @@ spec:
 	assert.Contains(t, rr.Body.String(), "Pod manifest applied successfully")
 }
 
+func testValidateHandler(t *testing.T) {
+	req, err := http.NewRequestWithContext(t.Context(), "POST", "/validate", strings.NewReader(`apiVersion: v1
+kind: Pod
+metadata:
+  name: test-pod
+  namespace: default
+spec:
+  containers:
+  - name: test-container
+    image: nginx`))
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(ValidateHandler)
+
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// a pod without containers is rejected by the api server
+	req, err = http.NewRequestWithContext(t.Context(), "POST", "/validate", strings.NewReader(`apiVersion: v1
+kind: Pod
+metadata:
+  name: test-pod
+  namespace: default
+spec:
+  containers: []`))
+	assert.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
 func testPodStatusHandler(t *testing.T) {
 	req, err := http.NewRequestWithContext(t.Context(), "GET", "/pods/default/test-pod/status", nil)
 	assert.NoError(t, err)
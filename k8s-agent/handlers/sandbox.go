@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/VedRatan/k8swatchdog/sanitize"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Labels of the shadow pods and of the objects copied for them. The labels of the original pod are dropped so that
+// no Service selects a shadow pod.
+const (
+	ShadowLabel   = "k8swatchdog.io/shadow"
+	ShadowIDLabel = "k8swatchdog.io/shadow-id"
+	ShadowOfLabel = "k8swatchdog.io/shadow-of"
+)
+
+// Shadow identifies a shadow pod and the objects created along with it
+type Shadow struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// CreateShadowHandler launches the pod manifest as a renamed shadow pod in the sandbox namespace given by the
+// namespace query parameter. The ConfigMaps and Secrets the pod references are copied next to it, the pod runs
+// without service account token and, with networkPolicy=true, is isolated by a deny-all NetworkPolicy.
+func CreateShadowHandler(w http.ResponseWriter, r *http.Request) {
+	sandbox := r.URL.Query().Get("namespace")
+	if sandbox == "" {
+		http.Error(w, "The namespace query parameter is required", http.StatusBadRequest)
+		return
+	}
+	isolate, _ := strconv.ParseBool(r.URL.Query().Get("networkPolicy"))
+	manifest, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	var decoded corev1.Pod
+	if err := yaml.Unmarshal(manifest, &decoded); err != nil {
+		logger.Error("Error occurred", zap.Error(err))
+		http.Error(w, "Failed to decode YAML manifest into Pod", http.StatusBadRequest)
+		return
+	}
+	pod := sanitize.Pod(&decoded)
+	source := pod.Namespace
+	if source == "" {
+		source = "default"
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil || volume.Ephemeral != nil {
+			http.Error(w, fmt.Sprintf("The pod mounts the volume %s backed by a PersistentVolumeClaim, it cannot be shadowed", volume.Name), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	id := utilrand.String(5)
+	shadow := &Shadow{ID: id, Namespace: sandbox, Name: shadowName(pod.Name, id)}
+	if err := createShadow(r.Context(), pod, source, shadow, isolate); err != nil {
+		logger.Error("failed to create shadow pod", zap.Error(err), zap.String("pod", source+"/"+pod.Name))
+		// whatever got created before the failure is removed
+		if cleanupErr := deleteShadow(context.Background(), sandbox, shadow.ID); cleanupErr != nil { //nolint:contextcheck
+			logger.Error("failed to clean up shadow pod", zap.Error(cleanupErr), zap.String("id", shadow.ID))
+		}
+		status := http.StatusInternalServerError
+		if apierrors.IsInvalid(err) || apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	logger.Info("shadow pod has been created", zap.String("pod", source+"/"+pod.Name), zap.String("shadow", sandbox+"/"+shadow.Name))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(shadow)
+	if err != nil {
+		logger.Error(LOG_ERROR_RESPONSE, zap.Error(err))
+		http.Error(w, fmt.Sprintf(ERROR_RESPONSE, err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteShadowHandler removes the shadow pod and every object created along with it
+func DeleteShadowHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := deleteShadow(r.Context(), vars["namespace"], vars["id"]); err != nil {
+		logger.Error("failed to delete shadow pod", zap.Error(err), zap.String("id", vars["id"]))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("shadow pod has been deleted", zap.String("namespace", vars["namespace"]), zap.String("id", vars["id"]))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func createShadow(ctx context.Context, pod *corev1.Pod, source string, shadow *Shadow, isolate bool) error {
+	labels := map[string]string{ShadowLabel: "true", ShadowIDLabel: shadow.ID, ShadowOfLabel: pod.Name}
+	meta := func(name string) v1.ObjectMeta {
+		return v1.ObjectMeta{Name: name, Namespace: shadow.Namespace, Labels: labels}
+	}
+	copyName := func(name string) string {
+		return shadowName(name, shadow.ID)
+	}
+
+	configMaps, secrets := references(&pod.Spec)
+	for name := range configMaps {
+		cm, err := clientset.CoreV1().ConfigMaps(source).Get(ctx, name, v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// optional references may be missing, the pod fails like the original would
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get the ConfigMap %s: %w", name, err)
+		}
+		copied := &corev1.ConfigMap{ObjectMeta: meta(copyName(name)), Data: cm.Data, BinaryData: cm.BinaryData}
+		if _, err := clientset.CoreV1().ConfigMaps(shadow.Namespace).Create(ctx, copied, v1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to copy the ConfigMap %s: %w", name, err)
+		}
+	}
+	for name := range secrets {
+		secret, err := clientset.CoreV1().Secrets(source).Get(ctx, name, v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get the Secret %s: %w", name, err)
+		}
+		copied := &corev1.Secret{ObjectMeta: meta(copyName(name)), Type: secret.Type, Data: secret.Data}
+		if _, err := clientset.CoreV1().Secrets(shadow.Namespace).Create(ctx, copied, v1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to copy the Secret %s: %w", name, err)
+		}
+	}
+	renameReferences(&pod.Spec, copyName)
+
+	if isolate {
+		policy := &networkingv1.NetworkPolicy{
+			ObjectMeta: meta(shadow.Name),
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: v1.LabelSelector{MatchLabels: map[string]string{ShadowIDLabel: shadow.ID}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			},
+		}
+		if _, err := clientset.NetworkingV1().NetworkPolicies(shadow.Namespace).Create(ctx, policy, v1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create the NetworkPolicy: %w", err)
+		}
+	}
+
+	automount := false
+	shadowPod := &corev1.Pod{ObjectMeta: meta(shadow.Name), Spec: pod.Spec}
+	shadowPod.Spec.ServiceAccountName = ""
+	shadowPod.Spec.DeprecatedServiceAccount = "" //nolint:staticcheck
+	shadowPod.Spec.AutomountServiceAccountToken = &automount
+	if _, err := clientset.CoreV1().Pods(shadow.Namespace).Create(ctx, shadowPod, v1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create the shadow pod: %w", err)
+	}
+	return nil
+}
+
+func deleteShadow(ctx context.Context, namespace, id string) error {
+	opts := v1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", ShadowIDLabel, id)}
+	for kind, deleteCollection := range map[string]func() error{
+		"pods": func() error {
+			return clientset.CoreV1().Pods(namespace).DeleteCollection(ctx, v1.DeleteOptions{}, opts)
+		},
+		"configmaps": func() error {
+			return clientset.CoreV1().ConfigMaps(namespace).DeleteCollection(ctx, v1.DeleteOptions{}, opts)
+		},
+		"secrets": func() error {
+			return clientset.CoreV1().Secrets(namespace).DeleteCollection(ctx, v1.DeleteOptions{}, opts)
+		},
+		"networkpolicies": func() error {
+			return clientset.NetworkingV1().NetworkPolicies(namespace).DeleteCollection(ctx, v1.DeleteOptions{}, opts)
+		},
+	} {
+		if err := deleteCollection(); err != nil {
+			return fmt.Errorf("failed to delete the shadow %s: %v", kind, err)
+		}
+	}
+	return nil
+}
+
+// references returns the names of the ConfigMaps and Secrets the pod spec uses
+func references(spec *corev1.PodSpec) (configMaps, secrets map[string]bool) {
+	configMaps, secrets = map[string]bool{}, map[string]bool{}
+	visit(spec, func(cm *string) { configMaps[*cm] = true }, func(secret *string) { secrets[*secret] = true })
+	return configMaps, secrets
+}
+
+// renameReferences points the ConfigMap and Secret references of the pod spec to their copies
+func renameReferences(spec *corev1.PodSpec, rename func(string) string) {
+	visit(spec, func(cm *string) { *cm = rename(*cm) }, func(secret *string) { *secret = rename(*secret) })
+}
+
+// visit calls configMap and secret with every ConfigMap and Secret name referenced by the pod spec
+func visit(spec *corev1.PodSpec, configMap, secret func(*string)) {
+	for i := range spec.ImagePullSecrets {
+		secret(&spec.ImagePullSecrets[i].Name)
+	}
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if volume.ConfigMap != nil {
+			configMap(&volume.ConfigMap.Name)
+		}
+		if volume.Secret != nil {
+			secret(&volume.Secret.SecretName)
+		}
+		if volume.Projected != nil {
+			for j := range volume.Projected.Sources {
+				source := &volume.Projected.Sources[j]
+				if source.ConfigMap != nil {
+					configMap(&source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					secret(&source.Secret.Name)
+				}
+			}
+		}
+	}
+	containers := func(list []corev1.Container) {
+		for i := range list {
+			for j := range list[i].EnvFrom {
+				if ref := list[i].EnvFrom[j].ConfigMapRef; ref != nil {
+					configMap(&ref.Name)
+				}
+				if ref := list[i].EnvFrom[j].SecretRef; ref != nil {
+					secret(&ref.Name)
+				}
+			}
+			for j := range list[i].Env {
+				if from := list[i].Env[j].ValueFrom; from != nil {
+					if from.ConfigMapKeyRef != nil {
+						configMap(&from.ConfigMapKeyRef.Name)
+					}
+					if from.SecretKeyRef != nil {
+						secret(&from.SecretKeyRef.Name)
+					}
+				}
+			}
+		}
+	}
+	containers(spec.InitContainers)
+	containers(spec.Containers)
+}
+
+// shadowName returns the name of the shadow of an object, within the 253 characters allowed for object names
+func shadowName(name, id string) string {
+	suffix := "-shadow-" + id
+	if len(name)+len(suffix) > 253 {
+		name = name[:253-len(suffix)]
+	}
+	return name + suffix
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// WaitStatus is streamed to the remediation-server as a server-sent event every time the watched object changes
+type WaitStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Ready   bool   `json:"ready"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// WatchPodHandler streams the readiness of a pod as server-sent events until the client disconnects
+func WatchPodHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	namespace := vars["namespace"]
+	podName := vars["podName"]
+
+	watcher, err := clientset.CoreV1().Pods(namespace).Watch(r.Context(), v1.ListOptions{
+		FieldSelector: fmt.Sprintf("metadata.name=%s", podName),
+	})
+	if err != nil {
+		logger.Error("failed to watch pod", zap.Error(err))
+		http.Error(w, fmt.Sprintf("Failed to create watcher %v", err), http.StatusInternalServerError)
+		return
+	}
+	streamStatus(w, r, watcher, func(obj runtime.Object) (WaitStatus, bool) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return WaitStatus{}, false
+		}
+		return podWaitStatus(pod), true
+	})
+}
+
+// WatchWorkloadHandler streams the rollout status of a Deployment, StatefulSet or DaemonSet as server-sent events
+func WatchWorkloadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	namespace := vars["namespace"]
+	name := vars["name"]
+	opts := v1.ListOptions{FieldSelector: fmt.Sprintf("metadata.name=%s", name)}
+
+	var watcher watch.Interface
+	var err error
+	switch strings.ToLower(vars["kind"]) {
+	case "deployment", "deployments":
+		watcher, err = clientset.AppsV1().Deployments(namespace).Watch(r.Context(), opts)
+	case "statefulset", "statefulsets":
+		watcher, err = clientset.AppsV1().StatefulSets(namespace).Watch(r.Context(), opts)
+	case "daemonset", "daemonsets":
+		watcher, err = clientset.AppsV1().DaemonSets(namespace).Watch(r.Context(), opts)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported workload kind %s", vars["kind"]), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to watch workload", zap.Error(err))
+		http.Error(w, fmt.Sprintf("Failed to create watcher %v", err), http.StatusInternalServerError)
+		return
+	}
+	streamStatus(w, r, watcher, rolloutStatus)
+}
+
+func streamStatus(w http.ResponseWriter, r *http.Request, watcher watch.Interface, status func(runtime.Object) (WaitStatus, bool)) {
+	defer watcher.Stop()
+
+	// the stream outlives the write timeout of the server, it ends when the client disconnects
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger.Error("failed to clear the write deadline", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Error(LOG_ERROR_RESPONSE, zap.Error(err))
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			var current WaitStatus
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if current, ok = status(event.Object); !ok {
+					continue
+				}
+			case watch.Deleted:
+				current = WaitStatus{Deleted: true, Reason: "Deleted"}
+			case watch.Error:
+				current = WaitStatus{Reason: "WatchError", Message: fmt.Sprintf("%v", event.Object)}
+			default:
+				continue
+			}
+			if err := writeEvent(w, rc, current); err != nil {
+				logger.Error(LOG_ERROR_RESPONSE, zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, status WaitStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// podWaitStatus reports whether the pod is Ready, together with the reason a container is not running
+func podWaitStatus(pod *corev1.Pod) WaitStatus {
+	status := WaitStatus{Phase: string(pod.Status.Phase)}
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		// the pod is part of a job and exited successfully
+		status.Ready = true
+		return status
+	case corev1.PodFailed:
+		status.Reason = "Failed"
+		status.Message = pod.Status.Message
+		return status
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+			status.Ready = true
+		}
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			status.Reason = condition.Reason
+			status.Message = condition.Message
+		}
+	}
+	containers := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, container := range containers {
+		if waiting := container.State.Waiting; waiting != nil && waiting.Reason != "" && waiting.Reason != "ContainerCreating" && waiting.Reason != "PodInitializing" {
+			status.Reason = waiting.Reason
+			status.Message = fmt.Sprintf("container %s: %s", container.Name, waiting.Message)
+			break
+		}
+	}
+	return status
+}
+
+// rolloutStatus reports whether the rollout of the workload is complete, in the same way as kubectl rollout status
+func rolloutStatus(obj runtime.Object) (WaitStatus, bool) {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		for _, condition := range workload.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				return WaitStatus{Reason: condition.Reason, Message: condition.Message}, true
+			}
+		}
+		replicas := int32(1)
+		if workload.Spec.Replicas != nil {
+			replicas = *workload.Spec.Replicas
+		}
+		s := workload.Status
+		ready := s.ObservedGeneration >= workload.Generation && s.UpdatedReplicas == replicas && s.Replicas == replicas && s.AvailableReplicas == replicas
+		return WaitStatus{Ready: ready, Message: fmt.Sprintf("%d of %d updated replicas are available", s.AvailableReplicas, replicas)}, true
+	case *appsv1.StatefulSet:
+		replicas := int32(1)
+		if workload.Spec.Replicas != nil {
+			replicas = *workload.Spec.Replicas
+		}
+		s := workload.Status
+		ready := s.ObservedGeneration >= workload.Generation && s.UpdatedReplicas == replicas && s.ReadyReplicas == replicas && s.CurrentRevision == s.UpdateRevision
+		return WaitStatus{Ready: ready, Message: fmt.Sprintf("%d of %d updated replicas are ready", s.ReadyReplicas, replicas)}, true
+	case *appsv1.DaemonSet:
+		s := workload.Status
+		ready := s.ObservedGeneration >= workload.Generation && s.UpdatedNumberScheduled == s.DesiredNumberScheduled && s.NumberAvailable == s.DesiredNumberScheduled
+		return WaitStatus{Ready: ready, Message: fmt.Sprintf("%d of %d updated pods are available", s.NumberAvailable, s.DesiredNumberScheduled)}, true
+	}
+	return WaitStatus{}, false
+}
@@ -34,9 +34,15 @@ func startServer(router *mux.Router) {
 func main() {
 	r := mux.NewRouter()
 	r.HandleFunc("/apply", handlers.ApplyHandler).Methods("POST")
+	r.HandleFunc("/validate", handlers.ValidateHandler).Methods("POST")
 	r.HandleFunc("/pods", handlers.ListPodsHandler).Methods("GET")
 	r.HandleFunc("/pods/{namespace}/{podName}/logs", handlers.StreamLogsHandler).Methods("GET")
 	r.HandleFunc("/pods/{namespace}/{podName}/status", handlers.PodStatusHandler).Methods("GET")
+	r.HandleFunc("/pods/{namespace}/{podName}/watch", handlers.WatchPodHandler).Methods("GET")
+	r.HandleFunc("/workloads/{kind}/{namespace}/{name}/watch", handlers.WatchWorkloadHandler).Methods("GET")
+	r.HandleFunc("/workloads/{kind}/{namespace}/{name}", handlers.PatchWorkloadHandler).Methods("PATCH")
+	r.HandleFunc("/sandbox", handlers.CreateShadowHandler).Methods("POST")
+	r.HandleFunc("/sandbox/{namespace}/{id}", handlers.DeleteShadowHandler).Methods("DELETE")
 	r.HandleFunc("/healthz", handlers.HealthCheckHandler).Methods("GET")
 	startServer(r)
 }
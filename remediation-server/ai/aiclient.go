@@ -5,18 +5,25 @@ import (
 	"fmt"
 
 	"github.com/VedRatan/remediation-server/ai/gemini"
+	"github.com/VedRatan/remediation-server/ai/ollama"
+	"github.com/VedRatan/remediation-server/ai/openai"
 	"github.com/VedRatan/remediation-server/types"
 )
 
-// AIClient interface allows to have multiple ai clients, if we plan in near future
+// AIClient interface allows to have multiple ai clients, the conversation lets the caller send follow-up
+// turns, ex: to feed a validation error back to the model
 type AIClient interface {
-	GenerateContent(ctx context.Context, prompt string) (string, error)
+	GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error)
 }
 
 func GetAiClient(ai string) (AIClient, error) {
 	switch ai {
 	case "gemini":
 		return gemini.NewGeminiClient(types.AiAgentKey), nil
+	case "openai":
+		return openai.NewOpenAIClient(types.OpenAIKey, types.OpenAIModel), nil
+	case "ollama":
+		return ollama.NewOllamaClient(types.OllamaURL, types.OllamaModel), nil
 	default:
 		return nil, fmt.Errorf("specified ai backend is not supported yet: %v", ai)
 	}
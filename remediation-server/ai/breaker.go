@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker keeps track of consecutive failures of a single backend. Once the failures reach the
+// threshold the breaker opens and the backend is skipped until the cooldown window has passed, after
+// which a single trial request is let through (half-open). A success closes the breaker again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	// trial is set while the half-open trial request is in flight, the other requests are refused until it reports
+	trial bool
+	now   func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a request may be sent to the backend. Once the cooldown has passed only the first caller
+// is allowed, it must report its outcome through success, failure or release.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	b.failures++
+	if b.failures >= b.threshold {
+		// (re)open the breaker, a failed half-open trial starts a fresh cooldown window
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// release ends a request without an outcome, ex: the caller gave up, a half-open trial can be made again
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// openUntilTime returns the time until which the breaker stays open, zero if it is closed.
+func (b *circuitBreaker) openUntilTime() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return time.Time{}
+	}
+	return b.openUntil
+}
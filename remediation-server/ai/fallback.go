@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+)
+
+// Generation is the raw reply of the AI together with the backend that produced it, see ParseProposal.
+type Generation struct {
+	Content string
+	Backend string
+	Tokens  int
+}
+
+type backend struct {
+	name    string
+	client  AIClient
+	breaker *circuitBreaker
+}
+
+// FallbackClient tries an ordered list of AI backends, skipping the ones whose circuit breaker is open,
+// until one of them returns a remediation.
+type FallbackClient struct {
+	backends []*backend
+	// slots bounds the concurrent generations, nil means unlimited
+	slots  chan struct{}
+	logger *zap.Logger
+}
+
+// NewFallbackClient builds the fallback chain for the given backend names, in order of preference.
+func NewFallbackClient(names []string, logger *zap.Logger) (*FallbackClient, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one ai backend must be configured")
+	}
+	f := &FallbackClient{logger: logger}
+	if types.MaxConcurrentAiCalls > 0 {
+		f.slots = make(chan struct{}, types.MaxConcurrentAiCalls)
+	}
+	for _, name := range names {
+		client, err := GetAiClient(name)
+		if err != nil {
+			return nil, err
+		}
+		f.backends = append(f.backends, &backend{
+			name:    name,
+			client:  client,
+			breaker: newCircuitBreaker(types.AiFailureThreshold, types.AiCooldown),
+		})
+	}
+	return f, nil
+}
+
+// ParseBackends splits a comma separated list of backend names, ex: "gemini,openai,ollama".
+func ParseBackends(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GenerateContent implements AIClient, it returns the reply of the first backend that succeeds.
+func (f *FallbackClient) GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error) {
+	gen, err := f.Generate(ctx, conversation)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Reply{Content: gen.Content, Tokens: gen.Tokens}, nil
+}
+
+// Generate walks the backends in order and returns the first successful generation. It waits for a free slot
+// first when types.MaxConcurrentAiCalls generations are already running.
+func (f *FallbackClient) Generate(ctx context.Context, conversation []types.Message) (*Generation, error) {
+	if f.slots != nil {
+		select {
+		case f.slots <- struct{}{}:
+			defer func() { <-f.slots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var errs []error
+	for _, b := range f.backends {
+		if !b.breaker.allow() {
+			f.logger.Info("skipping ai backend, circuit is open", zap.String("backend", b.name), zap.Time("openUntil", b.breaker.openUntilTime()))
+			errs = append(errs, fmt.Errorf("%s: circuit open", b.name))
+			continue
+		}
+		reply, err := b.client.GenerateContent(ctx, conversation)
+		if err != nil {
+			if ctx.Err() != nil {
+				// the caller gave up, this says nothing about the health of the backend
+				b.breaker.release()
+				return nil, ctx.Err()
+			}
+			b.breaker.failure()
+			f.logger.Error("ai backend failed, falling back to the next one", zap.String("backend", b.name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, err))
+			continue
+		}
+		b.breaker.success()
+		return &Generation{Content: reply.Content, Backend: b.name, Tokens: reply.Tokens}, nil
+	}
+	return nil, fmt.Errorf("all ai backends failed: %w", errors.Join(errs...))
+}
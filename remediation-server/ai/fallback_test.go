@@ -0,0 +1,129 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VedRatan/remediation-server/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeClient struct {
+	calls int
+	err   error
+}
+
+func (f *fakeClient) GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &types.Reply{Content: "```yaml\nkind: Pod\n```", Tokens: 10}, nil
+}
+
+func TestFallbackClient(t *testing.T) {
+	now := time.Now()
+	failing := &fakeClient{err: errors.New("429 too many requests")}
+	healthy := &fakeClient{}
+	prompt := []types.Message{{Role: types.RoleUser, Content: "prompt"}}
+	f := &FallbackClient{logger: zap.NewNop()}
+	for _, b := range []*backend{
+		{name: "gemini", client: failing, breaker: newCircuitBreaker(2, time.Minute)},
+		{name: "openai", client: healthy, breaker: newCircuitBreaker(2, time.Minute)},
+	} {
+		b.breaker.now = func() time.Time { return now }
+		f.backends = append(f.backends, b)
+	}
+
+	for i := 0; i < 3; i++ {
+		gen, err := f.Generate(t.Context(), prompt)
+		assert.NoError(t, err)
+		assert.Equal(t, "openai", gen.Backend)
+		assert.Equal(t, 10, gen.Tokens)
+	}
+	// the breaker opened after two failures, so the third call skipped gemini
+	assert.Equal(t, 2, failing.calls)
+
+	// after the cooldown a single trial request is let through again
+	now = now.Add(2 * time.Minute)
+	_, err := f.Generate(t.Context(), prompt)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failing.calls)
+
+	healthy.err = errors.New("503 service unavailable")
+	_, err = f.Generate(t.Context(), prompt)
+	assert.ErrorContains(t, err, "all ai backends failed")
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.failure()
+	assert.False(t, b.allow())
+
+	// a single caller probes the backend once the cooldown has passed, the others fail fast until it reports
+	now = now.Add(2 * time.Minute)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.release()
+	assert.True(t, b.allow())
+	b.failure()
+	assert.False(t, b.allow())
+
+	now = now.Add(2 * time.Minute)
+	assert.True(t, b.allow())
+	b.success()
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+}
+
+// slowClient records the highest number of generations running at once
+type slowClient struct {
+	running, peak atomic.Int32
+}
+
+func (s *slowClient) GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error) {
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+	for peak := s.peak.Load(); running > peak && !s.peak.CompareAndSwap(peak, running); peak = s.peak.Load() {
+	}
+	time.Sleep(20 * time.Millisecond)
+	return &types.Reply{Content: "ok"}, nil
+}
+
+func TestFallbackClientConcurrency(t *testing.T) {
+	slow := &slowClient{}
+	f := &FallbackClient{logger: zap.NewNop(), slots: make(chan struct{}, 2)}
+	f.backends = []*backend{{name: "gemini", client: slow, breaker: newCircuitBreaker(2, time.Minute)}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := f.Generate(t.Context(), nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), slow.peak.Load())
+
+	// a caller giving up while waiting for a slot is not blocked
+	f.slots <- struct{}{}
+	f.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	_, err := f.Generate(ctx, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestParseBackends(t *testing.T) {
+	assert.Equal(t, []string{"gemini", "openai", "ollama"}, ParseBackends(" Gemini, openai,,ollama "))
+	assert.Empty(t, ParseBackends(""))
+}
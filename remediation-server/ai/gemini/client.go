@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/types"
 )
 
 type GeminiClient struct {
@@ -17,40 +20,51 @@ func NewGeminiClient(apiKey string) *GeminiClient {
 	return &GeminiClient{apiKey: apiKey}
 }
 
-func (g *GeminiClient) GenerateContent(ctx context.Context, prompt string) (string, error) {
+func (g *GeminiClient) GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error) {
 	geminiURL := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent?key=%s", g.apiKey)
 
-	requestBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{
-						"text": prompt,
-					},
+	contents := make([]map[string]interface{}, 0, len(conversation))
+	for _, message := range conversation {
+		role := "user"
+		if message.Role == types.RoleAssistant {
+			role = "model" // gemini calls the assistant turns model
+		}
+		contents = append(contents, map[string]interface{}{
+			"role": role,
+			"parts": []map[string]string{
+				{
+					"text": message.Content,
 				},
 			},
+		})
+	}
+	requestBody := map[string]interface{}{
+		"contents": contents,
+		"generationConfig": map[string]interface{}{
+			"responseMimeType": "application/json",
+			"responseSchema":   geminiSchema(types.ProposalSchema),
 		},
 	}
 	requestBodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %v", err)
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", geminiURL, bytes.NewBuffer(requestBodyBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %v", err)
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make API call to Gemini: %v", err)
+		return nil, fmt.Errorf("failed to make API call to Gemini: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Gemini API returned non-200 status code: %d, body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("Gemini API returned non-200 status code: %d, body: %s", resp.StatusCode, string(body))
 	}
 
 	// defining the struct to hold the response body
@@ -62,16 +76,47 @@ func (g *GeminiClient) GenerateContent(ctx context.Context, prompt string) (stri
 				} `json:"parts"`
 			} `json:"content"`
 		} `json:"candidates"`
+		UsageMetadata struct {
+			TotalTokenCount int `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&geminiResponse); err != nil {
-		return "", fmt.Errorf("failed to decode Gemini response: %v", err)
+		return nil, fmt.Errorf("failed to decode Gemini response: %v", err)
 	}
 
 	if len(geminiResponse.Candidates) == 0 || len(geminiResponse.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no valid response from Gemini")
+		return nil, fmt.Errorf("no valid response from Gemini")
 	}
 
-	yaml := geminiResponse.Candidates[0].Content.Parts[0].Text
-	parsedYaml := extractYAMLFromResponse(yaml)
-	return parsedYaml, nil
+	return &types.Reply{
+		Content: geminiResponse.Candidates[0].Content.Parts[0].Text,
+		Tokens:  geminiResponse.UsageMetadata.TotalTokenCount,
+	}, nil
+}
+
+// geminiSchema converts a JSON schema into the OpenAPI subset expected by Gemini, which spells the types in upper case
+func geminiSchema(schema map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		switch v := value.(type) {
+		case string:
+			if key == "type" {
+				v = strings.ToUpper(v)
+			}
+			out[key] = v
+		case map[string]interface{}:
+			if key == "properties" {
+				props := make(map[string]interface{}, len(v))
+				for name, prop := range v {
+					props[name] = geminiSchema(prop.(map[string]interface{}))
+				}
+				out[key] = props
+			} else {
+				out[key] = geminiSchema(v)
+			}
+		default:
+			out[key] = v
+		}
+	}
+	return out
 }
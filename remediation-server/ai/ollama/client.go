@@ -0,0 +1,79 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/types"
+)
+
+const defaultModel = "llama3.1"
+
+type OllamaClient struct {
+	baseURL string
+	model   string
+}
+
+func NewOllamaClient(baseURL, model string) *OllamaClient {
+	if model == "" {
+		model = defaultModel
+	}
+	return &OllamaClient{baseURL: strings.TrimSuffix(baseURL, "/"), model: model}
+}
+
+func (o *OllamaClient) GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error) {
+	ollamaURL := fmt.Sprintf("%s/api/chat", o.baseURL)
+
+	requestBody := map[string]interface{}{
+		"model":    o.model,
+		"messages": conversation,
+		"stream":   false,
+		"format":   types.ProposalSchema,
+	}
+	requestBodyBytes, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ollamaURL, bytes.NewBuffer(requestBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make API call to Ollama: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama API returned non-200 status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var ollamaResponse struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		PromptEvalCount int `json:"prompt_eval_count"`
+		EvalCount       int `json:"eval_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode Ollama response: %v", err)
+	}
+
+	if ollamaResponse.Message.Content == "" {
+		return nil, fmt.Errorf("no valid response from Ollama")
+	}
+
+	return &types.Reply{
+		Content: ollamaResponse.Message.Content,
+		Tokens:  ollamaResponse.PromptEvalCount + ollamaResponse.EvalCount,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sort"
+
+	"github.com/VedRatan/remediation-server/types"
+)
+
+const defaultModel = "gpt-4o-mini"
+
+type OpenAIClient struct {
+	apiKey string
+	model  string
+}
+
+func NewOpenAIClient(apiKey, model string) *OpenAIClient {
+	if model == "" {
+		model = defaultModel
+	}
+	return &OpenAIClient{apiKey: apiKey, model: model}
+}
+
+func (o *OpenAIClient) GenerateContent(ctx context.Context, conversation []types.Message) (*types.Reply, error) {
+	openaiURL := "https://api.openai.com/v1/chat/completions"
+
+	requestBody := map[string]interface{}{
+		"model":    o.model,
+		"messages": conversation,
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "remediation",
+				"strict": true,
+				"schema": strictSchema(types.ProposalSchema),
+			},
+		},
+	}
+	requestBodyBytes, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", openaiURL, bytes.NewBuffer(requestBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make API call to OpenAI: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OpenAI API returned non-200 status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	// defining the struct to hold the response body
+	var openaiResponse struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&openaiResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAI response: %v", err)
+	}
+
+	if len(openaiResponse.Choices) == 0 {
+		return nil, fmt.Errorf("no valid response from OpenAI")
+	}
+
+	return &types.Reply{
+		Content: openaiResponse.Choices[0].Message.Content,
+		Tokens:  openaiResponse.Usage.TotalTokens,
+	}, nil
+}
+
+// strictSchema returns a copy of the schema that satisfies OpenAI strict mode, which requires additionalProperties
+// to be false and every property to be required, the optional properties are made nullable instead
+func strictSchema(schema map[string]interface{}) map[string]interface{} {
+	out := maps.Clone(schema)
+	if items, ok := out["items"].(map[string]interface{}); ok {
+		out["items"] = strictSchema(items)
+	}
+	properties, ok := out["properties"].(map[string]interface{})
+	if !ok {
+		return out
+	}
+	required := map[string]bool{}
+	if list, ok := out["required"].([]string); ok {
+		for _, name := range list {
+			required[name] = true
+		}
+	}
+	strict := make(map[string]interface{}, len(properties))
+	names := make([]string, 0, len(properties))
+	for name, prop := range properties {
+		p := strictSchema(prop.(map[string]interface{}))
+		if !required[name] {
+			p["type"] = []interface{}{p["type"], "null"}
+			if enum, ok := p["enum"].([]string); ok {
+				p["enum"] = append(append([]interface{}{}, stringsToAny(enum)...), nil)
+			}
+		}
+		strict[name] = p
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out["properties"] = strict
+	out["required"] = names
+	out["additionalProperties"] = false
+	return out
+}
+
+func stringsToAny(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/types"
+)
+
+// fencedBlock matches markdown code fences with an optional language, ex: ```yaml, ```yml, ```json or plain ```
+var fencedBlock = regexp.MustCompile("(?s)```([a-zA-Z]*)[ \\t]*\\r?\\n(.*?)```")
+
+// ParseProposal turns the reply of an ai backend into a Proposal. Replies following the JSON contract are
+// decoded directly, for backends or models that ignore it and answer with a manifest instead of an action plan
+// the manifest is recovered from ```yaml / ```yml fences, plain fences or an unfenced YAML reply.
+func ParseProposal(response string) (*types.Proposal, error) {
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return nil, fmt.Errorf("ai backend returned an empty response")
+	}
+
+	if proposal, ok := parseJSONProposal(response); ok {
+		return proposal, nil
+	}
+
+	manifest := extractManifest(response)
+	if manifest == "" {
+		return nil, fmt.Errorf("no action plan found in the ai response")
+	}
+	return &types.Proposal{Manifest: manifest}, nil
+}
+
+func parseJSONProposal(response string) (*types.Proposal, bool) {
+	candidates := []string{response}
+	for _, match := range fencedBlock.FindAllStringSubmatch(response, -1) {
+		if strings.EqualFold(match[1], "json") || match[1] == "" {
+			candidates = append(candidates, match[2])
+		}
+	}
+	for _, candidate := range candidates {
+		var proposal types.Proposal
+		if err := json.Unmarshal([]byte(strings.TrimSpace(candidate)), &proposal); err != nil {
+			continue
+		}
+		// models sometimes wrap the manifest string itself in a fence
+		proposal.Manifest = extractManifest(proposal.Manifest)
+		if len(proposal.Actions) > 0 || proposal.Manifest != "" {
+			return &proposal, true
+		}
+	}
+	return nil, false
+}
+
+// extractManifest returns the first block of the response that looks like a Kubernetes manifest
+func extractManifest(response string) string {
+	matches := fencedBlock.FindAllStringSubmatch(response, -1)
+	for _, match := range matches {
+		lang := strings.ToLower(match[1])
+		if lang != "yaml" && lang != "yml" && lang != "" {
+			continue
+		}
+		if block := strings.TrimSpace(match[2]); looksLikeManifest(block) {
+			return block
+		}
+	}
+	if len(matches) == 0 && looksLikeManifest(response) {
+		return strings.TrimSpace(response)
+	}
+	return ""
+}
+
+func looksLikeManifest(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "kind:") || strings.HasPrefix(line, "apiVersion:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/VedRatan/remediation-server/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const manifest = "apiVersion: v1\nkind: Pod\nmetadata:\n  name: faulty-pod"
+
+func TestParseProposal(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "json", response: `{"manifest": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: faulty-pod", "explanation": "bad image", "confidence": 0.8, "changedFields": ["spec.containers[0].image"]}`},
+		{name: "fenced json", response: "```json\n{\"manifest\": \"apiVersion: v1\\nkind: Pod\\nmetadata:\\n  name: faulty-pod\"}\n```"},
+		{name: "yaml fence", response: "Here is the fix:\n```yaml\n" + manifest + "\n```\nDone."},
+		{name: "yml fence", response: "```yml\n" + manifest + "\n```"},
+		{name: "plain fence", response: "```\n" + manifest + "\n```"},
+		{name: "multiple blocks", response: "```bash\nkubectl get pods\n```\n```yaml\n" + manifest + "\n```"},
+		{name: "unfenced", response: manifest},
+		{name: "no manifest", response: "I am not able to help with that.", wantErr: true},
+		{name: "empty", response: "  ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proposal, err := ParseProposal(tt.response)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, manifest, proposal.Manifest)
+		})
+	}
+}
+
+func TestParseActionPlan(t *testing.T) {
+	proposal, err := ParseProposal("```json\n" + `{"actions": [{"type": "setImage", "container": "app", "image": "nginx:1.27"},
+{"type": "setResources", "container": "app", "memoryLimit": "512Mi", "cpuLimit": null}], "explanation": "bad tag", "confidence": 0.9}` + "\n```")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Action{
+		{Type: "setImage", Container: "app", Image: "nginx:1.27"},
+		{Type: "setResources", Container: "app", MemoryLimit: "512Mi"},
+	}, proposal.Actions)
+	assert.Empty(t, proposal.Manifest)
+	assert.Equal(t, "bad tag", proposal.Explanation)
+
+	_, err = ParseProposal(`{"actions": [], "explanation": "nothing to do"}`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+// Package analyzer implements native analyzers for the common workload failures that k8sgpt reports. Each analyzer
+// lists the objects of its kind and emits a Finding shaped like a k8sgpt Result, so the controller can remediate it
+// through the same pipeline.
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Key identifies the object of a finding, it is the workqueue item of the findings
+type Key struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// Finding is a faulty object found by an analyzer
+type Finding struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// ParentObject is the Kind/name of the workload owning the faulty object or backing it, ex: the Deployment of
+	// the pods a Service selects. Empty if there is none
+	ParentObject string
+	Errors       []string
+}
+
+func (f Finding) Key() Key {
+	return Key{Kind: f.Kind, Namespace: f.Namespace, Name: f.Name}
+}
+
+// Details describes the errors of the finding, in place of the details of a k8sgpt Result
+func (f Finding) Details() string {
+	var details strings.Builder
+	fmt.Fprintf(&details, "The %s %s/%s is failing:", f.Kind, f.Namespace, f.Name)
+	for _, text := range f.Errors {
+		details.WriteString("\n- " + text)
+	}
+	if f.ParentObject != "" {
+		fmt.Fprintf(&details, "\nIt is backed by the %s.", f.ParentObject)
+	}
+	return details.String()
+}
+
+// Analyzer finds the faulty objects of a kind
+type Analyzer interface {
+	// Name is the name the analyzer is enabled by, the kind it analyzes
+	Name() string
+	Analyze(ctx context.Context, c client.Client) ([]Finding, error)
+}
+
+// All returns every analyzer
+func All() []Analyzer {
+	return []Analyzer{
+		DeploymentAnalyzer{},
+		ServiceAnalyzer{},
+		IngressAnalyzer{},
+		PersistentVolumeClaimAnalyzer{},
+		CronJobAnalyzer{},
+		PodAnalyzer{},
+	}
+}
+
+// Names returns the names of every analyzer
+func Names() []string {
+	var names []string
+	for _, analyzer := range All() {
+		names = append(names, analyzer.Name())
+	}
+	return names
+}
+
+// Select returns the analyzers with the given names
+func Select(names []string) ([]Analyzer, error) {
+	var analyzers []Analyzer
+	for _, name := range names {
+		i := slices.IndexFunc(All(), func(a Analyzer) bool { return strings.EqualFold(a.Name(), name) })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown analyzer %q, expected one of %s", name, strings.Join(Names(), ", "))
+		}
+		analyzers = append(analyzers, All()[i])
+	}
+	return analyzers, nil
+}
+
+// Run runs the analyzers and returns their findings outside of the ignored namespaces. An analyzer failing does
+// not stop the others, their errors are joined.
+func Run(ctx context.Context, c client.Client, analyzers []Analyzer, ignoreNamespaces []string) ([]Finding, error) {
+	var findings []Finding
+	var errs []error
+	for _, analyzer := range analyzers {
+		found, err := analyzer.Analyze(ctx, c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("the %s analyzer failed: %v", analyzer.Name(), err))
+		}
+		for _, finding := range found {
+			if !slices.Contains(ignoreNamespaces, finding.Namespace) {
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings, errors.Join(errs...)
+}
+
+// parentOf returns the Kind/name of the workload owning the pod, a ReplicaSet is resolved to its Deployment
+func parentOf(ctx context.Context, c client.Client, pod *corev1.Pod) string {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return ""
+	}
+	if ref.Kind == "ReplicaSet" {
+		var rs appsv1.ReplicaSet
+		if err := c.Get(ctx, apitypes.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, &rs); err == nil {
+			if deployRef := metav1.GetControllerOf(&rs); deployRef != nil && deployRef.Kind == "Deployment" {
+				return "Deployment/" + deployRef.Name
+			}
+		}
+	}
+	return ref.Kind + "/" + ref.Name
+}
+
+func isReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newClient(objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+	utilruntime.Must(batchv1.AddToScheme(scheme))
+	utilruntime.Must(networkingv1.AddToScheme(scheme))
+	utilruntime.Must(storagev1.AddToScheme(scheme))
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func meta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Namespace: "shop", Name: name}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestDeploymentAnalyzer(t *testing.T) {
+	rolledOut := &appsv1.Deployment{
+		ObjectMeta: meta("web"),
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+		Status:     appsv1.DeploymentStatus{UpdatedReplicas: 3, AvailableReplicas: 1},
+	}
+	rollingOut := &appsv1.Deployment{
+		ObjectMeta: meta("api"),
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+		Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+	stuck := &appsv1.Deployment{
+		ObjectMeta: meta("worker"),
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(1)},
+		Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{{
+			Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+			Message: `ReplicaSet "worker-6d4f" has timed out progressing.`,
+		}}},
+	}
+	findings, err := DeploymentAnalyzer{}.Analyze(context.Background(), newClient(rolledOut, rollingOut, stuck))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Finding{
+		{Kind: "Deployment", Namespace: "shop", Name: "web", Errors: []string{"the Deployment has 1 available replicas of 3"}},
+		{Kind: "Deployment", Namespace: "shop", Name: "worker", Errors: []string{
+			"the Deployment has 0 available replicas of 1",
+			`the rollout is stuck: ReplicaSet "worker-6d4f" has timed out progressing.`,
+		}},
+	}, findings)
+}
+
+func TestServiceAnalyzer(t *testing.T) {
+	selector := map[string]string{"app": "web"}
+	deploy := &appsv1.Deployment{ObjectMeta: meta("web")}
+	rs := &appsv1.ReplicaSet{ObjectMeta: meta("web-6d4f")}
+	rs.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", Controller: boolPtr(true)}}
+	pod := &corev1.Pod{ObjectMeta: meta("web-6d4f-abcde")}
+	pod.Labels = selector
+	pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-6d4f", Controller: boolPtr(true)}}
+
+	web := &corev1.Service{ObjectMeta: meta("web"), Spec: corev1.ServiceSpec{Selector: selector}}
+	orphan := &corev1.Service{ObjectMeta: meta("orphan"), Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "gone"}}}
+	healthy := &corev1.Service{ObjectMeta: meta("api"), Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "api"}}}
+	endpoints := &corev1.Endpoints{ObjectMeta: meta("api"), Subsets: []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}}}}
+	external := &corev1.Service{ObjectMeta: meta("db"), Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "db.example.com"}}
+
+	findings, err := ServiceAnalyzer{}.Analyze(context.Background(), newClient(deploy, rs, pod, web, orphan, healthy, endpoints, external))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Finding{
+		{Kind: "Service", Namespace: "shop", Name: "web", ParentObject: "Deployment/web",
+			Errors: []string{"the Service has no ready endpoints, its pods are not Ready: web-6d4f-abcde"}},
+		{Kind: "Service", Namespace: "shop", Name: "orphan", Errors: []string{"the Service has no endpoints, no pod matches its selector app=gone"}},
+	}, findings)
+}
+
+func TestIngressAnalyzer(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: meta("web"), Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}}}
+	backend := func(name string, port networkingv1.ServiceBackendPort) networkingv1.HTTPIngressPath {
+		return networkingv1.HTTPIngressPath{Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: name, Port: port}}}
+	}
+	ingress := &networkingv1.Ingress{ObjectMeta: meta("shop"), Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+		IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+			backend("web", networkingv1.ServiceBackendPort{Number: 80}),
+			backend("web", networkingv1.ServiceBackendPort{Name: "grpc"}),
+			backend("cart", networkingv1.ServiceBackendPort{Number: 80}),
+			backend("cart", networkingv1.ServiceBackendPort{Number: 80}),
+		}}},
+	}}}}
+
+	findings, err := IngressAnalyzer{}.Analyze(context.Background(), newClient(svc, ingress))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{{Kind: "Ingress", Namespace: "shop", Name: "shop", Errors: []string{
+		"the Ingress uses the port grpc which the Service web does not expose",
+		"the Ingress uses the Service cart which does not exist",
+	}}}, findings)
+}
+
+func TestPersistentVolumeClaimAnalyzer(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	stuck := &corev1.PersistentVolumeClaim{ObjectMeta: meta("data"), Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: ptr("fast")},
+		Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending}}
+	stuck.CreationTimestamp = old
+	provisioning := &corev1.PersistentVolumeClaim{ObjectMeta: meta("cache"), Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending}}
+	provisioning.CreationTimestamp = metav1.Now()
+	bound := &corev1.PersistentVolumeClaim{ObjectMeta: meta("logs"), Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound}}
+	bound.CreationTimestamp = old
+
+	findings, err := PersistentVolumeClaimAnalyzer{}.Analyze(context.Background(), newClient(stuck, provisioning, bound))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{{Kind: "PersistentVolumeClaim", Namespace: "shop", Name: "data", Errors: []string{
+		"the PersistentVolumeClaim is Pending since " + old.UTC().Format(time.RFC3339),
+		"the StorageClass fast does not exist",
+	}}}, findings)
+}
+
+func TestCronJobAnalyzer(t *testing.T) {
+	cronJob := &batchv1.CronJob{ObjectMeta: meta("report")}
+	cronJob.UID = apitypes.UID("report-uid")
+	recovered := &batchv1.CronJob{ObjectMeta: meta("backup")}
+	recovered.UID = apitypes.UID("backup-uid")
+	job := func(owner *batchv1.CronJob, name string, age time.Duration, condition batchv1.JobConditionType) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: meta(name)}
+		job.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		job.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: owner.Name, UID: owner.UID, Controller: boolPtr(true)}}
+		if condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}}
+		}
+		return job
+	}
+
+	findings, err := CronJobAnalyzer{}.Analyze(context.Background(), newClient(cronJob, recovered,
+		job(cronJob, "report-1", 3*time.Hour, batchv1.JobComplete),
+		job(cronJob, "report-2", 2*time.Hour, batchv1.JobFailed),
+		job(cronJob, "report-3", time.Hour, batchv1.JobFailed),
+		job(cronJob, "report-4", time.Minute, ""),
+		job(recovered, "backup-1", 2*time.Hour, batchv1.JobFailed),
+		job(recovered, "backup-2", time.Hour, batchv1.JobComplete),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{{Kind: "CronJob", Namespace: "shop", Name: "report", Errors: []string{
+		"the last 2 Jobs of the CronJob failed",
+		"the Job report-3 failed: BackoffLimitExceeded Job has reached the specified backoff limit",
+		"the Job report-2 failed: BackoffLimitExceeded Job has reached the specified backoff limit",
+	}}}, findings)
+}
+
+func TestPodAnalyzer(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: meta("settings"), Data: map[string]string{"mode": "prod"}}
+	secret := &corev1.Secret{ObjectMeta: meta("tls")}
+	pod := &corev1.Pod{ObjectMeta: meta("web"), Spec: corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "certs", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+			{Name: "extra", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "extra"}, Optional: boolPtr(true)}}},
+		},
+		Containers: []corev1.Container{{
+			Name:    "app",
+			EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db-credentials"}}}},
+			Env: []corev1.EnvVar{
+				{Name: "MODE", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "mode"}}},
+				{Name: "LEVEL", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "level"}}},
+			},
+		}},
+	}}
+	ready := pod.DeepCopy()
+	ready.Name = "web-ready"
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+
+	findings, err := PodAnalyzer{}.Analyze(context.Background(), newClient(cm, secret, pod, ready))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{{Kind: "Pod", Namespace: "shop", Name: "web", Errors: []string{
+		"the container app uses the Secret db-credentials which does not exist",
+		"the container app uses the key level of the ConfigMap settings which does not exist",
+	}}}, findings)
+}
+
+func TestFinding(t *testing.T) {
+	finding := Finding{Kind: "Service", Namespace: "shop", Name: "web", ParentObject: "Deployment/web", Errors: []string{"no endpoints"}}
+	assert.Equal(t, Key{Kind: "Service", Namespace: "shop", Name: "web"}, finding.Key())
+	assert.Equal(t, "The Service shop/web is failing:\n- no endpoints\nIt is backed by the Deployment/web.", finding.Details())
+
+	analyzers, err := Select([]string{"deployment", "Pod"})
+	require.NoError(t, err)
+	assert.Equal(t, []Analyzer{DeploymentAnalyzer{}, PodAnalyzer{}}, analyzers)
+	_, err = Select([]string{"Node"})
+	assert.ErrorContains(t, err, `unknown analyzer "Node"`)
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ServiceAnalyzer finds the Services with a selector but no ready endpoints
+type ServiceAnalyzer struct{}
+
+func (ServiceAnalyzer) Name() string { return "Service" }
+
+func (ServiceAnalyzer) Analyze(ctx context.Context, c client.Client) ([]Finding, error) {
+	var list corev1.ServiceList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the Services: %v", err)
+	}
+	var findings []Finding
+	for _, svc := range list.Items {
+		if len(svc.Spec.Selector) == 0 || svc.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+		var endpoints corev1.Endpoints
+		if err := c.Get(ctx, apitypes.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, &endpoints); err != nil && !apierrors.IsNotFound(err) {
+			return findings, fmt.Errorf("failed to get the Endpoints of the Service %s/%s: %v", svc.Namespace, svc.Name, err)
+		}
+		var ready int
+		var notReady []string
+		for _, subset := range endpoints.Subsets {
+			ready += len(subset.Addresses)
+			for _, address := range subset.NotReadyAddresses {
+				if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+					notReady = append(notReady, address.TargetRef.Name)
+				}
+			}
+		}
+		if ready > 0 {
+			continue
+		}
+
+		var pods corev1.PodList
+		if err := c.List(ctx, &pods, client.InNamespace(svc.Namespace), client.MatchingLabels(svc.Spec.Selector)); err != nil {
+			return findings, fmt.Errorf("failed to list the pods of the Service %s/%s: %v", svc.Namespace, svc.Name, err)
+		}
+		finding := Finding{Kind: "Service", Namespace: svc.Namespace, Name: svc.Name}
+		if len(pods.Items) == 0 {
+			finding.Errors = []string{fmt.Sprintf("the Service has no endpoints, no pod matches its selector %s", labels.SelectorFromSet(svc.Spec.Selector))}
+			findings = append(findings, finding)
+			continue
+		}
+		sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+		if len(notReady) == 0 {
+			for _, pod := range pods.Items {
+				if !isReady(&pod) {
+					notReady = append(notReady, pod.Name)
+				}
+			}
+		}
+		sort.Strings(notReady)
+		finding.Errors = []string{fmt.Sprintf("the Service has no ready endpoints, its pods are not Ready: %s", strings.Join(notReady, ", "))}
+		for _, pod := range pods.Items {
+			if !isReady(&pod) {
+				finding.ParentObject = parentOf(ctx, c, &pod)
+				break
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+// IngressAnalyzer finds the Ingresses routing to Services or ports which do not exist
+type IngressAnalyzer struct{}
+
+func (IngressAnalyzer) Name() string { return "Ingress" }
+
+func (IngressAnalyzer) Analyze(ctx context.Context, c client.Client) ([]Finding, error) {
+	var list networkingv1.IngressList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the Ingresses: %v", err)
+	}
+	var findings []Finding
+	for _, ingress := range list.Items {
+		var backends []*networkingv1.IngressServiceBackend
+		if ingress.Spec.DefaultBackend != nil && ingress.Spec.DefaultBackend.Service != nil {
+			backends = append(backends, ingress.Spec.DefaultBackend.Service)
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					backends = append(backends, path.Backend.Service)
+				}
+			}
+		}
+		var errs []string
+		for _, backend := range backends {
+			var svc corev1.Service
+			err := c.Get(ctx, apitypes.NamespacedName{Namespace: ingress.Namespace, Name: backend.Name}, &svc)
+			switch {
+			case apierrors.IsNotFound(err):
+				errs = appendOnce(errs, fmt.Sprintf("the Ingress uses the Service %s which does not exist", backend.Name))
+			case err != nil:
+				return findings, fmt.Errorf("failed to get the Service %s/%s: %v", ingress.Namespace, backend.Name, err)
+			case !exposes(&svc, backend.Port):
+				errs = appendOnce(errs, fmt.Sprintf("the Ingress uses the port %s which the Service %s does not expose", portString(backend.Port), backend.Name))
+			}
+		}
+		if len(errs) > 0 {
+			findings = append(findings, Finding{Kind: "Ingress", Namespace: ingress.Namespace, Name: ingress.Name, Errors: errs})
+		}
+	}
+	return findings, nil
+}
+
+func exposes(svc *corev1.Service, port networkingv1.ServiceBackendPort) bool {
+	for _, p := range svc.Spec.Ports {
+		if (port.Name != "" && p.Name == port.Name) || (port.Name == "" && p.Port == port.Number) {
+			return true
+		}
+	}
+	return false
+}
+
+func portString(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return fmt.Sprint(port.Number)
+}
+
+func appendOnce(list []string, item string) []string {
+	if slices.Contains(list, item) {
+		return list
+	}
+	return append(list, item)
+}
@@ -0,0 +1,120 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PodAnalyzer finds the pods which are not Ready and reference ConfigMaps, ConfigMap keys or Secrets which do not
+// exist. Only the metadata of the Secrets is read.
+type PodAnalyzer struct{}
+
+func (PodAnalyzer) Name() string { return "Pod" }
+
+func (PodAnalyzer) Analyze(ctx context.Context, c client.Client) ([]Finding, error) {
+	var pods corev1.PodList
+	if err := c.List(ctx, &pods); err != nil {
+		return nil, fmt.Errorf("failed to list the pods: %v", err)
+	}
+	var configMaps corev1.ConfigMapList
+	if err := c.List(ctx, &configMaps); err != nil {
+		return nil, fmt.Errorf("failed to list the ConfigMaps: %v", err)
+	}
+	secrets := &metav1.PartialObjectMetadataList{}
+	secrets.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("SecretList"))
+	if err := c.List(ctx, secrets); err != nil {
+		return nil, fmt.Errorf("failed to list the Secrets: %v", err)
+	}
+	// configMapKeys maps the namespace/name of the ConfigMaps to their keys
+	configMapKeys := map[string]map[string]bool{}
+	for _, cm := range configMaps.Items {
+		keys := map[string]bool{}
+		for key := range cm.Data {
+			keys[key] = true
+		}
+		for key := range cm.BinaryData {
+			keys[key] = true
+		}
+		configMapKeys[cm.Namespace+"/"+cm.Name] = keys
+	}
+	secretNames := map[string]bool{}
+	for _, secret := range secrets.Items {
+		secretNames[secret.Namespace+"/"+secret.Name] = true
+	}
+
+	var findings []Finding
+	for _, pod := range pods.Items {
+		if isReady(&pod) || pod.Status.Phase == corev1.PodSucceeded || pod.DeletionTimestamp != nil {
+			continue
+		}
+		var errs []string
+		configMap := func(name, key string, optional *bool, user string) {
+			if optional != nil && *optional {
+				return
+			}
+			keys, ok := configMapKeys[pod.Namespace+"/"+name]
+			switch {
+			case !ok:
+				errs = appendOnce(errs, fmt.Sprintf("%s uses the ConfigMap %s which does not exist", user, name))
+			case key != "" && !keys[key]:
+				errs = appendOnce(errs, fmt.Sprintf("%s uses the key %s of the ConfigMap %s which does not exist", user, key, name))
+			}
+		}
+		secret := func(name string, optional *bool, user string) {
+			if (optional == nil || !*optional) && !secretNames[pod.Namespace+"/"+name] {
+				errs = appendOnce(errs, fmt.Sprintf("%s uses the Secret %s which does not exist", user, name))
+			}
+		}
+
+		for _, volume := range pod.Spec.Volumes {
+			user := "the volume " + volume.Name
+			if volume.ConfigMap != nil {
+				configMap(volume.ConfigMap.Name, "", volume.ConfigMap.Optional, user)
+			}
+			if volume.Secret != nil {
+				secret(volume.Secret.SecretName, volume.Secret.Optional, user)
+			}
+			if volume.Projected != nil {
+				for _, source := range volume.Projected.Sources {
+					if source.ConfigMap != nil {
+						configMap(source.ConfigMap.Name, "", source.ConfigMap.Optional, user)
+					}
+					if source.Secret != nil {
+						secret(source.Secret.Name, source.Secret.Optional, user)
+					}
+				}
+			}
+		}
+		containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, container := range containers {
+			user := "the container " + container.Name
+			for _, env := range container.EnvFrom {
+				if env.ConfigMapRef != nil {
+					configMap(env.ConfigMapRef.Name, "", env.ConfigMapRef.Optional, user)
+				}
+				if env.SecretRef != nil {
+					secret(env.SecretRef.Name, env.SecretRef.Optional, user)
+				}
+			}
+			for _, env := range container.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+					configMap(ref.Name, ref.Key, ref.Optional, user)
+				}
+				if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+					secret(ref.Name, ref.Optional, user)
+				}
+			}
+		}
+		if len(errs) > 0 {
+			findings = append(findings, Finding{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, ParentObject: parentOf(ctx, c, &pod), Errors: errs})
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pendingGrace is how long a PersistentVolumeClaim may stay Pending while its volume is provisioned
+const pendingGrace = 5 * time.Minute
+
+// PersistentVolumeClaimAnalyzer finds the PersistentVolumeClaims stuck Pending
+type PersistentVolumeClaimAnalyzer struct{}
+
+func (PersistentVolumeClaimAnalyzer) Name() string { return "PersistentVolumeClaim" }
+
+func (PersistentVolumeClaimAnalyzer) Analyze(ctx context.Context, c client.Client) ([]Finding, error) {
+	var list corev1.PersistentVolumeClaimList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the PersistentVolumeClaims: %v", err)
+	}
+	var findings []Finding
+	for _, pvc := range list.Items {
+		if pvc.Status.Phase != corev1.ClaimPending || time.Since(pvc.CreationTimestamp.Time) < pendingGrace {
+			continue
+		}
+		errs := []string{fmt.Sprintf("the PersistentVolumeClaim is Pending since %s", pvc.CreationTimestamp.UTC().Format(time.RFC3339))}
+		if class := pvc.Spec.StorageClassName; class != nil && *class != "" {
+			var storageClass storagev1.StorageClass
+			err := c.Get(ctx, apitypes.NamespacedName{Name: *class}, &storageClass)
+			switch {
+			case apierrors.IsNotFound(err):
+				errs = append(errs, fmt.Sprintf("the StorageClass %s does not exist", *class))
+			case err != nil:
+				return findings, fmt.Errorf("failed to get the StorageClass %s: %v", *class, err)
+			}
+		}
+		if pvc.Spec.VolumeName != "" {
+			errs = append(errs, fmt.Sprintf("the PersistentVolume %s it is bound to is not available", pvc.Spec.VolumeName))
+		}
+		findings = append(findings, Finding{Kind: "PersistentVolumeClaim", Namespace: pvc.Namespace, Name: pvc.Name, Errors: errs})
+	}
+	return findings, nil
+}
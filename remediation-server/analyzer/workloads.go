@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cronJobFailures is how many of the last Jobs of a CronJob have to fail in a row for it to be faulty
+const cronJobFailures = 2
+
+// DeploymentAnalyzer finds the Deployments with unavailable replicas once their rollout is over, the replicas of a
+// rollout in progress are expected to be unavailable for a while
+type DeploymentAnalyzer struct{}
+
+func (DeploymentAnalyzer) Name() string { return "Deployment" }
+
+func (DeploymentAnalyzer) Analyze(ctx context.Context, c client.Client) ([]Finding, error) {
+	var list appsv1.DeploymentList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the Deployments: %v", err)
+	}
+	var findings []Finding
+	for _, deploy := range list.Items {
+		desired := int32(1)
+		if deploy.Spec.Replicas != nil {
+			desired = *deploy.Spec.Replicas
+		}
+		if desired == 0 || deploy.Status.AvailableReplicas >= desired {
+			continue
+		}
+		var errs []string
+		rolledOut := deploy.Status.ObservedGeneration >= deploy.Generation && deploy.Status.UpdatedReplicas >= desired
+		for _, condition := range deploy.Status.Conditions {
+			switch {
+			case condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded":
+				errs = append(errs, fmt.Sprintf("the rollout is stuck: %s", condition.Message))
+			case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue:
+				errs = append(errs, fmt.Sprintf("the replicas cannot be created: %s", condition.Message))
+			case condition.Type == appsv1.DeploymentAvailable && condition.Status == corev1.ConditionFalse && rolledOut:
+				errs = append(errs, fmt.Sprintf("the Deployment is unavailable: %s", condition.Message))
+			}
+		}
+		if len(errs) == 0 && !rolledOut {
+			continue
+		}
+		errs = append([]string{fmt.Sprintf("the Deployment has %d available replicas of %d", deploy.Status.AvailableReplicas, desired)}, errs...)
+		findings = append(findings, Finding{Kind: "Deployment", Namespace: deploy.Namespace, Name: deploy.Name, Errors: errs})
+	}
+	return findings, nil
+}
+
+// CronJobAnalyzer finds the CronJobs whose last Jobs failed in a row
+type CronJobAnalyzer struct{}
+
+func (CronJobAnalyzer) Name() string { return "CronJob" }
+
+func (CronJobAnalyzer) Analyze(ctx context.Context, c client.Client) ([]Finding, error) {
+	var cronJobs batchv1.CronJobList
+	if err := c.List(ctx, &cronJobs); err != nil {
+		return nil, fmt.Errorf("failed to list the CronJobs: %v", err)
+	}
+	var jobs batchv1.JobList
+	if err := c.List(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to list the Jobs: %v", err)
+	}
+	jobsOf := map[string][]batchv1.Job{}
+	for _, job := range jobs.Items {
+		if ref := metav1.GetControllerOf(&job); ref != nil && ref.Kind == "CronJob" {
+			jobsOf[string(ref.UID)] = append(jobsOf[string(ref.UID)], job)
+		}
+	}
+	var findings []Finding
+	for _, cronJob := range cronJobs.Items {
+		if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+			continue
+		}
+		owned := jobsOf[string(cronJob.UID)]
+		sort.Slice(owned, func(i, j int) bool {
+			return owned[j].CreationTimestamp.Before(&owned[i].CreationTimestamp)
+		})
+		var failures []string
+		for _, job := range owned {
+			failed := jobFailure(&job)
+			if failed == "" {
+				if jobFinished(&job) {
+					break
+				}
+				// the running Jobs do not break the series
+				continue
+			}
+			failures = append(failures, fmt.Sprintf("the Job %s failed: %s", job.Name, failed))
+		}
+		if len(failures) < cronJobFailures {
+			continue
+		}
+		errs := append([]string{fmt.Sprintf("the last %d Jobs of the CronJob failed", len(failures))}, failures...)
+		findings = append(findings, Finding{Kind: "CronJob", Namespace: cronJob.Namespace, Name: cronJob.Name, Errors: errs})
+	}
+	return findings, nil
+}
+
+// jobFailure returns the reason and message of the Failed condition of the job, empty if it did not fail
+func jobFailure(job *batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return strings.TrimSpace(condition.Reason + " " + condition.Message)
+		}
+	}
+	return ""
+}
+
+func jobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobComplete && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+// Package detector finds faulty pods without the k8sgpt operator. It watches the Warning events of the pods and
+// the transitions of their status into a failure, and enqueues a Finding into the workqueue of the controller
+// once the object has been quiet for the debounce window, so that a burst of events leads to a single remediation.
+package detector
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// WarningReasons are the reasons of the Warning events that make a pod faulty
+var WarningReasons = []string{"BackOff", "Failed", "FailedScheduling", "Unhealthy", "FailedMount"}
+
+// failingWaitingReasons are the reasons a container waits for that will not resolve on their own
+var failingWaitingReasons = []string{
+	"CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError",
+}
+
+// shadowLabel marks the shadow pods the k8s-agent launches in the sandbox, they are never remediated
+const shadowLabel = "k8swatchdog.io/shadow"
+
+// maxReasons caps the reasons collected for a single finding
+const maxReasons = 10
+
+// eventMaxAge is the age above which an event is considered stale, ex: the events listed at startup
+const eventMaxAge = 10 * time.Minute
+
+var (
+	podsGVR   = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	eventsGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+)
+
+// Finding is a pod the detector found faulty, it is the workqueue item taking the place of a k8sgpt Result
+type Finding struct {
+	Namespace string
+	Name      string
+}
+
+// Config configures the detector
+type Config struct {
+	// Debounce is how long the detector waits for more events of an object before it enqueues its finding
+	Debounce time.Duration
+	// IgnoreNamespaces are never watched, ex: kube-system or the sandbox namespace
+	IgnoreNamespaces []string
+}
+
+// Detector collects the reasons of the faulty pods until their finding is taken from the workqueue
+type Detector struct {
+	queue  workqueue.TypedDelayingInterface[any]
+	config Config
+	logger *zap.Logger
+
+	mu sync.Mutex
+	// pending maps the findings waiting in the workqueue to their reasons
+	pending map[Finding][]string
+}
+
+func New(queue workqueue.TypedDelayingInterface[any], config Config, logger *zap.Logger) *Detector {
+	return &Detector{
+		queue:   queue,
+		config:  config,
+		logger:  logger,
+		pending: map[Finding][]string{},
+	}
+}
+
+// Register adds the handlers of the detector to the pods and events informers of the factory and returns them
+func (d *Detector) Register(factory dynamicinformer.DynamicSharedInformerFactory) ([]cache.SharedIndexInformer, error) {
+	pods := factory.ForResource(podsGVR).Informer()
+	if _, err := pods.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { d.onPod(nil, obj) },
+		UpdateFunc: d.onPod,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to register the pod handler: %v", err)
+	}
+	events := factory.ForResource(eventsGVR).Informer()
+	if _, err := events.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { d.onEvent(nil, obj) },
+		UpdateFunc: d.onEvent,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to register the event handler: %v", err)
+	}
+	return []cache.SharedIndexInformer{pods, events}, nil
+}
+
+// Take returns the reasons of the finding, the finding is enqueued again if new reasons come up afterwards
+func (d *Detector) Take(finding Finding) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	reasons := d.pending[finding]
+	delete(d.pending, finding)
+	return reasons
+}
+
+// Details describes the reasons of the finding, in place of the details of a k8sgpt Result
+func Details(finding Finding, reasons []string) string {
+	var details strings.Builder
+	fmt.Fprintf(&details, "The pod %s/%s is failing:", finding.Namespace, finding.Name)
+	for _, reason := range reasons {
+		details.WriteString("\n- " + reason)
+	}
+	return details.String()
+}
+
+// observe adds the reason to the finding, a new finding is enqueued after the debounce window
+func (d *Detector) observe(finding Finding, reason string) {
+	d.mu.Lock()
+	reasons, pending := d.pending[finding]
+	if !slices.Contains(reasons, reason) && len(reasons) < maxReasons {
+		reasons = append(reasons, reason)
+	}
+	d.pending[finding] = reasons
+	d.mu.Unlock()
+	if !pending {
+		d.logger.Info("detected a faulty pod", zap.String("pod", finding.Namespace+"/"+finding.Name), zap.String("reason", reason))
+		d.queue.AddAfter(finding, d.config.Debounce)
+	}
+}
+
+func (d *Detector) ignored(namespace string) bool {
+	return slices.Contains(d.config.IgnoreNamespaces, namespace)
+}
+
+// onPod observes the problems the pod did not have before
+func (d *Detector) onPod(oldObj, newObj interface{}) {
+	pod := &corev1.Pod{}
+	if !convert(newObj, pod) || d.ignored(pod.Namespace) || pod.Labels[shadowLabel] != "" || pod.DeletionTimestamp != nil {
+		return
+	}
+	before := map[string]string{}
+	if oldObj != nil {
+		old := &corev1.Pod{}
+		if convert(oldObj, old) {
+			before = Problems(old)
+		}
+	}
+	problems := Problems(pod)
+	keys := make([]string, 0, len(problems))
+	for key := range problems {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d.observe(Finding{Namespace: pod.Namespace, Name: pod.Name}, problems[key])
+	}
+}
+
+// onEvent observes the Warning events of the pods with one of the WarningReasons
+func (d *Detector) onEvent(oldObj, newObj interface{}) {
+	event := &corev1.Event{}
+	if !convert(newObj, event) || event.Type != corev1.EventTypeWarning || event.InvolvedObject.Kind != "Pod" ||
+		!slices.Contains(WarningReasons, event.Reason) || d.ignored(event.InvolvedObject.Namespace) {
+		return
+	}
+	if oldObj != nil {
+		// the resync delivers the unchanged events again
+		if old := oldObj.(*unstructured.Unstructured); old.GetResourceVersion() == event.ResourceVersion {
+			return
+		}
+	}
+	last := event.LastTimestamp.Time
+	if event.Series != nil {
+		last = event.Series.LastObservedTime.Time
+	} else if last.IsZero() {
+		last = event.EventTime.Time
+	}
+	if !last.IsZero() && time.Since(last) > eventMaxAge {
+		return
+	}
+	d.observe(Finding{Namespace: event.InvolvedObject.Namespace, Name: event.InvolvedObject.Name},
+		fmt.Sprintf("Warning %s: %s", event.Reason, strings.TrimSpace(event.Message)))
+}
+
+// Problems returns the failures of the pod by a key identifying them, ex: app/CrashLoopBackOff
+func Problems(pod *corev1.Pod) map[string]string {
+	problems := map[string]string{}
+	if pod.Status.Phase == corev1.PodFailed {
+		problems["phase/Failed"] = strings.TrimSpace(fmt.Sprintf("the pod failed: %s %s", pod.Status.Reason, pod.Status.Message))
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			problems["scheduled/Unschedulable"] = fmt.Sprintf("the pod cannot be scheduled: %s", condition.Message)
+		}
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil && slices.Contains(failingWaitingReasons, waiting.Reason) {
+			problems[status.Name+"/"+waiting.Reason] = strings.TrimSpace(fmt.Sprintf("the container %s is waiting: %s %s", status.Name, waiting.Reason, waiting.Message))
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			problems[status.Name+"/OOMKilled"] = fmt.Sprintf("the container %s was OOMKilled", status.Name)
+		}
+	}
+	return problems
+}
+
+func convert(obj interface{}, into interface{}) bool {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, into) == nil
+}
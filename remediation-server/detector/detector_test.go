@@ -0,0 +1,112 @@
+package detector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func toUnstructured(t *testing.T, obj interface{}) *unstructured.Unstructured {
+	t.Helper()
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+	return &unstructured.Unstructured{Object: u}
+}
+
+func newDetector() (*Detector, workqueue.TypedDelayingInterface[any]) {
+	queue := workqueue.NewTypedDelayingQueue[any]()
+	return New(queue, Config{Debounce: 10 * time.Millisecond, IgnoreNamespaces: []string{"kube-system"}}, zap.NewNop()), queue
+}
+
+func waitingPod(namespace, reason string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "web", ResourceVersion: "2"},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "back-off 5m0s"}},
+			}},
+		},
+	}
+}
+
+func TestProblems(t *testing.T) {
+	pod := waitingPod("shop", "CrashLoopBackOff")
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: "OOMKilled"}
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable, Message: "0/3 nodes are available",
+	}}
+	assert.Equal(t, map[string]string{
+		"app/CrashLoopBackOff":    "the container app is waiting: CrashLoopBackOff back-off 5m0s",
+		"app/OOMKilled":           "the container app was OOMKilled",
+		"scheduled/Unschedulable": "the pod cannot be scheduled: 0/3 nodes are available",
+	}, Problems(pod))
+
+	assert.Empty(t, Problems(waitingPod("shop", "ContainerCreating")), "a container being created is not failing")
+}
+
+func TestOnPod(t *testing.T) {
+	d, queue := newDetector()
+	defer queue.ShutDown()
+
+	healthy := waitingPod("shop", "ContainerCreating")
+	crashing := waitingPod("shop", "CrashLoopBackOff")
+	d.onPod(toUnstructured(t, healthy), toUnstructured(t, crashing))
+	// the resync delivers the same failing pod again
+	d.onPod(toUnstructured(t, crashing), toUnstructured(t, crashing))
+	d.onPod(nil, toUnstructured(t, waitingPod("kube-system", "CrashLoopBackOff")))
+	shadow := waitingPod("sandbox", "CrashLoopBackOff")
+	shadow.Labels = map[string]string{shadowLabel: "true"}
+	d.onPod(nil, toUnstructured(t, shadow))
+
+	item, _ := queue.Get()
+	assert.Equal(t, Finding{Namespace: "shop", Name: "web"}, item)
+	queue.Done(item)
+	assert.Equal(t, []string{"the container app is waiting: CrashLoopBackOff back-off 5m0s"}, d.Take(Finding{Namespace: "shop", Name: "web"}))
+	assert.Zero(t, queue.Len(), "the ignored pods are not enqueued")
+}
+
+func TestOnEvent(t *testing.T) {
+	d, queue := newDetector()
+	defer queue.ShutDown()
+
+	event := func(eventType, reason, kind string, last time.Time) *unstructured.Unstructured {
+		return toUnstructured(t, &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "shop", Name: "web.1", ResourceVersion: "1"},
+			InvolvedObject: corev1.ObjectReference{Kind: kind, Namespace: "shop", Name: "web"},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        "Back-off restarting failed container",
+			LastTimestamp:  metav1.NewTime(last),
+		})
+	}
+	d.onEvent(nil, event(corev1.EventTypeNormal, "Pulled", "Pod", time.Now()))
+	d.onEvent(nil, event(corev1.EventTypeWarning, "BackOff", "Deployment", time.Now()))
+	d.onEvent(nil, event(corev1.EventTypeWarning, "BackOff", "Pod", time.Now().Add(-time.Hour)))
+	assert.Empty(t, d.pending, "the normal, non-pod and stale events are ignored")
+
+	d.onEvent(nil, event(corev1.EventTypeWarning, "BackOff", "Pod", time.Now()))
+	d.onEvent(nil, event(corev1.EventTypeWarning, "BackOff", "Pod", time.Now()))
+	d.onEvent(nil, event(corev1.EventTypeWarning, "Unhealthy", "Pod", time.Now()))
+
+	item, _ := queue.Get()
+	queue.Done(item)
+	finding := item.(Finding)
+	reasons := d.Take(finding)
+	assert.Equal(t, []string{
+		"Warning BackOff: Back-off restarting failed container",
+		"Warning Unhealthy: Back-off restarting failed container",
+	}, reasons)
+	assert.Equal(t, "The pod shop/web is failing:\n- Warning BackOff: Back-off restarting failed container\n"+
+		"- Warning Unhealthy: Back-off restarting failed container", Details(finding, reasons))
+	assert.Zero(t, queue.Len(), "a finding is enqueued once per debounce window")
+}
@@ -4,16 +4,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/VedRatan/remediation-server/types"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 )
 
+// ErrNotReady is returned when the remediated object did not become Ready, either because it failed or because
+// the verification timed out
+var ErrNotReady = errors.New("did not become Ready")
+
 // function to  extract pod name and namespace from the provided remediationYAML
 func ExtractPodDetails(remediationYAML string) (string, string, error) {
 	obj := &unstructured.Unstructured{}
@@ -32,15 +41,28 @@ func ExtractPodDetails(remediationYAML string) (string, string, error) {
 	return podName, namespace, nil
 }
 
-func ApplyRemediation(remediationYAML string) error {
-	var url string
+// agentURL builds the url of a k8s-agent endpoint
+func agentURL(path string) string {
 	// conditional url building based on the type of connection between remediation-server and k8s-agent
 	if types.Insecure {
-		url = fmt.Sprintf("http://%s/apply", types.K8sAgentServiceURL)
-	} else {
-		url = fmt.Sprintf("https://%s/apply", types.K8sAgentServiceURL)
+		return fmt.Sprintf("http://%s%s", types.K8sAgentServiceURL, path)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return fmt.Sprintf("https://%s%s", types.K8sAgentServiceURL, path)
+}
+
+func ApplyRemediation(ctx context.Context, remediationYAML string) error {
+	return applyPod(ctx, remediationYAML, "/apply")
+}
+
+// RollbackPod re-creates the original pod through the k8s-agent, the agent reports it as a rollback in the events
+// of the pod
+func RollbackPod(ctx context.Context, podYAML string) error {
+	return applyPod(ctx, podYAML, "/apply?action=rollback")
+}
+
+func applyPod(ctx context.Context, remediationYAML, path string) error {
+	url := agentURL(path)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(remediationYAML))
 	if err != nil {
@@ -64,36 +86,22 @@ func ApplyRemediation(remediationYAML string) error {
 	return nil
 }
 
-func VerifyPodStatus(namespace, podName string, isRemediated bool) error {
-	statusURL := fmt.Sprintf("http://%s/pods/%s/%s/status", types.K8sAgentServiceURL, namespace, podName)
-	// If the pod is remediated, it will take some time to comeup in a ready state
-	if isRemediated {
-		for i := 0; i < 5; i++ { // Retry 5 times with a delay
-			time.Sleep(10 * time.Second) // Wait for 10 seconds before checking the status
-			status, err := getPodStatus(statusURL)
-			if err != nil {
-				return err
-			}
-			// Check if the pod is in the Ready state
-			if isPodReady(status) {
-				return nil
-			}
-		}
-	} else {
-		status, err := getPodStatus(statusURL)
-		if err != nil {
-			return err
-		}
-		if isPodReady(status) {
-			return nil
-		}
+// VerifyPodStatus checks whether the pod is currently in the Ready state
+func VerifyPodStatus(ctx context.Context, namespace, podName string) error {
+	status, err := getPodStatus(ctx, agentURL(fmt.Sprintf("/pods/%s/%s/status", namespace, podName)))
+	if err != nil {
+		return err
 	}
-
-	return fmt.Errorf("pod %s/%s did not reach Ready state within the timeout period", namespace, podName)
+	if !isPodReady(status) {
+		return fmt.Errorf("pod %s/%s is not Ready", namespace, podName)
+	}
+	return nil
 }
 
-func getPodStatus(statusURL string) (map[string]interface{}, error) {
-	req, err := http.NewRequestWithContext(context.Background(), "GET", statusURL, nil)
+func getPodStatus(ctx context.Context, statusURL string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating GET request: %v", err)
 	}
@@ -137,3 +145,188 @@ func isPodReady(status map[string]interface{}) bool {
 
 	return false
 }
+
+// RejectedError is returned when the k8s-agent rejects a manifest in the server-side dry-run, ex: an admission denial
+type RejectedError struct {
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("manifest rejected by the server-side dry-run: %s", e.Message)
+}
+
+// ValidateRemediation asks the k8s-agent to dry-run the remediation YAML and returns the pod as the api server
+// would create it, a *RejectedError is returned if the api server refuses the manifest
+func ValidateRemediation(ctx context.Context, remediationYAML string) (*corev1.Pod, error) {
+	url := agentURL("/validate")
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(remediationYAML))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating POST request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send remediation YAML to k8s-agent: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if resp.StatusCode == http.StatusUnprocessableEntity || resp.StatusCode == http.StatusBadRequest {
+			return nil, &RejectedError{Message: strings.TrimSpace(string(bodyBytes))}
+		}
+		return nil, fmt.Errorf("k8s-agent returned non-OK status: %s | response: %s", resp.Status, string(bodyBytes))
+	}
+
+	var pod corev1.Pod
+	if err := json.NewDecoder(resp.Body).Decode(&pod); err != nil {
+		return nil, fmt.Errorf("failed to decode the dry-run pod: %v", err)
+	}
+	return &pod, nil
+}
+
+// PatchWorkload applies a targeted patch of the given content type to a workload through the k8s-agent
+func PatchWorkload(ctx context.Context, kind, namespace, name, contentType string, patch []byte) error {
+	return patchWorkload(ctx, fmt.Sprintf("/workloads/%s/%s/%s", strings.ToLower(kind), namespace, name), contentType, patch)
+}
+
+// RollbackWorkload applies the patch restoring a workload through the k8s-agent, the agent reports it as a rollback
+// in the events of the workload
+func RollbackWorkload(ctx context.Context, kind, namespace, name, contentType string, patch []byte) error {
+	return patchWorkload(ctx, fmt.Sprintf("/workloads/%s/%s/%s?action=rollback", strings.ToLower(kind), namespace, name), contentType, patch)
+}
+
+func patchWorkload(ctx context.Context, path, contentType string, patch []byte) error {
+	url := agentURL(path)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, bytes.NewReader(patch))
+	if err != nil {
+		return fmt.Errorf("Error creating PATCH request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send the patch to k8s-agent: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+		return fmt.Errorf("k8s-agent returned non-OK status: %s | response: %s", resp.Status, string(bodyBytes))
+	}
+	return nil
+}
+
+// LogOptions selects the logs fetched by GetPodLogs, the zero value returns all logs of the only container
+type LogOptions struct {
+	Container string
+	// Previous returns the logs of the previous instance of the container, ex: before it crashed
+	Previous  bool
+	TailLines int
+}
+
+// GetPodLogs fetches the logs of the pod through the k8s-agent
+func GetPodLogs(ctx context.Context, namespace, podName string, opts LogOptions) (string, error) {
+	query := url.Values{}
+	if opts.Container != "" {
+		query.Set("container", opts.Container)
+	}
+	if opts.Previous {
+		query.Set("previous", "true")
+	}
+	if opts.TailLines > 0 {
+		query.Set("tailLines", strconv.Itoa(opts.TailLines))
+	}
+	logsURL := agentURL(fmt.Sprintf("/pods/%s/%s/logs", namespace, podName))
+	if len(query) > 0 {
+		logsURL += "?" + query.Encode()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", logsURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error creating GET request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pod logs: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("k8s-agent returned non-OK status: %s | response: %s", resp.Status, string(body))
+	}
+	return string(body), nil
+}
+
+// Shadow identifies a shadow pod launched by the k8s-agent in the sandbox namespace
+type Shadow struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// CreateShadow asks the k8s-agent to launch the remediation YAML as a shadow pod in the sandbox namespace
+func CreateShadow(ctx context.Context, remediationYAML, namespace string, networkPolicy bool) (*Shadow, error) {
+	query := url.Values{}
+	query.Set("namespace", namespace)
+	query.Set("networkPolicy", strconv.FormatBool(networkPolicy))
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", agentURL("/sandbox?"+query.Encode()), bytes.NewBufferString(remediationYAML))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating POST request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send the shadow pod to k8s-agent: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		return nil, fmt.Errorf("k8s-agent returned non-OK status: %s | response: %s", resp.Status, string(bodyBytes))
+	}
+	var shadow Shadow
+	if err := json.NewDecoder(resp.Body).Decode(&shadow); err != nil {
+		return nil, fmt.Errorf("failed to decode the shadow pod: %v", err)
+	}
+	return &shadow, nil
+}
+
+// DeleteShadow asks the k8s-agent to remove the shadow pod and the objects created along with it
+func DeleteShadow(ctx context.Context, shadow *Shadow) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, agentURL(fmt.Sprintf("/sandbox/%s/%s", shadow.Namespace, shadow.ID)), nil)
+	if err != nil {
+		return fmt.Errorf("Error creating DELETE request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete the shadow pod through k8s-agent: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("k8s-agent returned non-OK status: %s | response: %s", resp.Status, string(bodyBytes))
+	}
+	return nil
+}
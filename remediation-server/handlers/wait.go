@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VedRatan/remediation-server/types"
+)
+
+// failureReasons are states reported by the k8s-agent that will not resolve on their own, the wait gives up
+// as soon as one of them is seen instead of running into the timeout
+var failureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+	"Failed":                     true,
+	"Deleted":                    true,
+	"ProgressDeadlineExceeded":   true,
+}
+
+// waitStatus is the event streamed by the watch endpoints of the k8s-agent
+type waitStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Ready   bool   `json:"ready"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// WaitForReady follows the readiness of the object through the watch stream of the k8s-agent. Pods have to be
+// Ready, Deployments, StatefulSets and DaemonSets have to complete their rollout. The object must then stay
+// healthy for the stability window of its kind. An error wrapping ErrNotReady is returned as soon as the object
+// clearly fails, ex: CrashLoopBackOff, or when the timeout of its kind expires. The error of ctx is returned as is
+// when ctx is done first, the object was not found failing.
+func WaitForReady(ctx context.Context, kind, namespace, name string) error {
+	timeout := types.VerifyTimeouts.For(kind)
+	stability := types.VerifyStability.For(kind)
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var watchURL string
+	if strings.EqualFold(kind, "Pod") {
+		watchURL = agentURL(fmt.Sprintf("/pods/%s/%s/watch", namespace, name))
+	} else {
+		watchURL = agentURL(fmt.Sprintf("/workloads/%s/%s/%s/watch", strings.ToLower(kind), namespace, name))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", watchURL, nil)
+	if err != nil {
+		return fmt.Errorf("Error creating GET request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if parent.Err() != nil {
+			return parent.Err()
+		}
+		return fmt.Errorf("failed to watch %s %s/%s: %v", kind, namespace, name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("k8s-agent returned non-OK status: %s | response: %s", resp.Status, string(body))
+	}
+
+	stream := make(chan waitStatus)
+	go readEvents(ctx, resp.Body, stream)
+	events := (<-chan waitStatus)(stream)
+
+	var last waitStatus
+	var stable *time.Timer
+	stableC := func() <-chan time.Time {
+		if stable == nil {
+			return nil
+		}
+		return stable.C
+	}
+	defer func() {
+		if stable != nil {
+			stable.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return parent.Err()
+			}
+			return fmt.Errorf("%s %s/%s %w within %s, last status: %s %s", kind, namespace, name, ErrNotReady, timeout, last.Reason, last.Message)
+		case <-stableC():
+			return nil
+		case status, ok := <-events:
+			if !ok {
+				if ctx.Err() == nil {
+					return fmt.Errorf("watch stream of %s %s/%s ended unexpectedly", kind, namespace, name)
+				}
+				events = nil // the stream was closed by the timeout, which is reported above
+				continue
+			}
+			last = status
+			if failureReasons[status.Reason] {
+				return fmt.Errorf("%s %s/%s %w: %s %s", kind, namespace, name, ErrNotReady, status.Reason, status.Message)
+			}
+			switch {
+			case status.Ready && stable == nil:
+				if stability <= 0 {
+					return nil
+				}
+				stable = time.NewTimer(stability)
+			case !status.Ready && stable != nil:
+				// the object flapped, the stability window starts over once it is Ready again
+				stable.Stop()
+				stable = nil
+			}
+		}
+	}
+}
+
+// readEvents decodes the server-sent events of the body until it ends
+func readEvents(ctx context.Context, body io.Reader, events chan<- waitStatus) {
+	defer close(events)
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var status waitStatus
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			continue
+		}
+		select {
+		case events <- status:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VedRatan/remediation-server/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func agentStub(t *testing.T, events ...string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	types.Insecure = true
+	types.K8sAgentServiceURL = strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestWaitForReady(t *testing.T) {
+	types.VerifyTimeouts = types.DurationMap{"*": 500 * time.Millisecond}
+	types.VerifyStability = types.DurationMap{"*": 50 * time.Millisecond}
+
+	agentStub(t, `{"phase":"Pending","ready":false,"reason":"ContainerCreating"}`, `{"phase":"Running","ready":true}`)
+	assert.NoError(t, WaitForReady(t.Context(), "Pod", "default", "test-pod"))
+
+	agentStub(t, `{"phase":"Running","ready":false,"reason":"CrashLoopBackOff","message":"back-off restarting failed container"}`)
+	err := WaitForReady(t.Context(), "Pod", "default", "test-pod")
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.ErrorContains(t, err, "CrashLoopBackOff")
+
+	agentStub(t, `{"ready":false,"message":"0 of 2 updated replicas are available"}`)
+	start := time.Now()
+	err = WaitForReady(t.Context(), "Deployment", "default", "test-deployment")
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+
+	// a cancelled caller is not a failed verification
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	err = WaitForReady(ctx, "Deployment", "default", "test-deployment")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrNotReady)
+}
+
+func TestDurationMap(t *testing.T) {
+	m := types.DurationMap{"*": time.Minute}
+	assert.NoError(t, m.Set("Pod=2m, Deployment=10m"))
+	assert.Equal(t, 2*time.Minute, m.For("pod"))
+	assert.Equal(t, 10*time.Minute, m.For("Deployment"))
+	assert.Equal(t, time.Minute, m.For("StatefulSet"))
+	assert.Error(t, m.Set("Pod"))
+}
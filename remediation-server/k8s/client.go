@@ -8,6 +8,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -29,7 +30,8 @@ func NewDynamicClient() dynamic.Interface {
 	return clientSet
 }
 
-func NewOrDie(scheme *runtime.Scheme) client.Client {
+// configOrDie loads the in-cluster config, or the kubeconfig of the user when running outside of a cluster
+func configOrDie() *rest.Config {
 	config, err := rest.InClusterConfig()
 	if err != nil && errors.Is(err, rest.ErrNotInCluster) {
 		kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
@@ -38,7 +40,11 @@ func NewOrDie(scheme *runtime.Scheme) client.Client {
 			panic(fmt.Sprintf("failed to load kubeconfig '%v', error: %v\n", kubeconfig, err))
 		}
 	}
-	k8sClient, err := client.New(config, client.Options{
+	return config
+}
+
+func NewOrDie(scheme *runtime.Scheme) client.Client {
+	k8sClient, err := client.New(configOrDie(), client.Options{
 		Scheme: scheme,
 	})
 	if err != nil {
@@ -46,3 +52,12 @@ func NewOrDie(scheme *runtime.Scheme) client.Client {
 	}
 	return k8sClient
 }
+
+// NewClientsetOrDie creates a typed clientset, ex: for the event recorders
+func NewClientsetOrDie() kubernetes.Interface {
+	clientset, err := kubernetes.NewForConfig(configOrDie())
+	if err != nil {
+		panic(fmt.Sprintf("failed to create clientset, error: %v", err))
+	}
+	return clientset
+}
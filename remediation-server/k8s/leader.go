@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// ErrLeadershipLost is returned by RunAsLeader when the Lease was lost before ctx was done, ex: the api server could
+// not be reached to renew it
+var ErrLeadershipLost = errors.New("lost the leadership")
+
+// LeaderElection configures the Lease electing the replica that runs the controller
+type LeaderElection struct {
+	Namespace string
+	Name      string
+	// Identity identifies the replica in the Lease, it must be unique across the replicas
+	Identity      string
+	LeaseDuration time.Duration
+}
+
+// RunAsLeader blocks until the replica holds the Lease, then runs lead with a context cancelled when ctx is done or
+// the Lease is lost. lead must return once the work it guards has stopped. The Lease is released as soon as lead
+// returned, so that another replica takes over without waiting for the Lease to expire. Once the Lease is lost,
+// ErrLeadershipLost is returned as soon as lead returned, or before another replica can acquire the Lease if lead
+// is still running, the caller must then exit.
+func RunAsLeader(ctx context.Context, election LeaderElection, lead func(ctx context.Context), logger *zap.Logger) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: election.Namespace, Name: election.Name},
+		Client:     NewClientsetOrDie().CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: election.Identity},
+	}
+
+	// the election outlives ctx while leading, the Lease must only be released once lead returned
+	electionCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	var leading atomic.Bool
+	stopWaiting := context.AfterFunc(ctx, func() {
+		if !leading.Load() {
+			cancel()
+		}
+	})
+	defer stopWaiting()
+
+	// the work of lead is cancelled as soon as the Lease is lost, another replica may acquire it meanwhile
+	leadCtx, stopLeading := context.WithCancelCause(ctx)
+	defer stopLeading(nil)
+
+	done := make(chan struct{})
+	renewDeadline := election.LeaseDuration * 2 / 3
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            election.Name,
+		LeaseDuration:   election.LeaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     election.LeaseDuration / 5,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				defer close(done)
+				defer cancel()
+				leading.Store(true)
+				logger.Info("became the leader", zap.String("lease", election.Namespace+"/"+election.Name), zap.String("identity", election.Identity))
+				lead(leadCtx)
+			},
+			OnStoppedLeading: func() {
+				logger.Info("stopped leading", zap.String("identity", election.Identity))
+				stopLeading(ErrLeadershipLost)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != election.Identity {
+					logger.Info("waiting for the leadership", zap.String("leader", identity))
+				}
+			},
+		},
+	})
+	if !leading.Load() {
+		return nil
+	}
+	if ctx.Err() != nil {
+		<-done
+		return nil
+	}
+	// the Lease was last renewed a renew deadline ago, another replica acquires it once the Lease duration is over
+	select {
+	case <-done:
+	case <-time.After(election.LeaseDuration - renewDeadline):
+		logger.Error("the work did not stop before another replica can acquire the Lease", zap.String("identity", election.Identity))
+	}
+	return ErrLeadershipLost
+}
@@ -0,0 +1,87 @@
+package k8scontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/analyzer"
+	"github.com/VedRatan/remediation-server/notify"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+)
+
+// workloadKinds are the kinds a finding can be remediated through, the other findings are reported through their
+// parent object or notified only
+var workloadKinds = []string{"Pod", "Deployment", "StatefulSet", "DaemonSet"}
+
+// runAnalyzers runs the built-in analyzers and enqueues the findings which are new or whose errors changed since
+// the previous run, the findings gone are forgotten so that they are remediated again if they come back
+func (c *controller) runAnalyzers(ctx context.Context) {
+	findings, err := analyzer.Run(ctx, c.clientset, c.analyzers, c.ignoreNamespaces)
+	if err != nil {
+		c.Logger.Error("analysis failed", zap.Error(err))
+	}
+	seen := map[analyzer.Key]string{}
+	for _, finding := range findings {
+		key := finding.Key()
+		errs := strings.Join(finding.Errors, "\n")
+		seen[key] = errs
+		if previous, ok := c.analyzed[key]; ok && previous == errs {
+			continue
+		}
+		c.Logger.Info("analyzer found a faulty object", zap.String("kind", key.Kind), zap.String("name", key.Namespace+"/"+key.Name),
+			zap.Strings("errors", finding.Errors))
+		c.findingsMu.Lock()
+		c.findings[key] = finding
+		c.findingsMu.Unlock()
+		c.queue.Add(key)
+	}
+	c.analyzed = seen
+}
+
+// remediateAnalysis remediates the object of a finding of the analyzers. The findings of other kinds, ex: a
+// Service without endpoints, are remediated through their parent workload when they have one, the others can only
+// be fixed by a human and are notified.
+func (c *controller) remediateAnalysis(ctx context.Context, key analyzer.Key) {
+	c.findingsMu.Lock()
+	finding, ok := c.findings[key]
+	delete(c.findings, key)
+	c.findingsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	request := types.ObjectRequest{Kind: finding.Kind, Namespace: finding.Namespace, Name: finding.Name, Problem: finding.Details()}
+	if !slices.Contains(workloadKinds, finding.Kind) {
+		kind, name, _ := strings.Cut(finding.ParentObject, "/")
+		if !slices.Contains(workloadKinds, kind) {
+			c.notifier.Notify(ctx, notify.Notification{
+				Text:    fmt.Sprintf("%s %s/%s: cannot be remediated automatically, %s", finding.Kind, finding.Namespace, finding.Name, strings.Join(finding.Errors, ", ")),
+				Target:  finding.Namespace + "/" + finding.Name,
+				Kind:    finding.Kind,
+				Message: finding.Details(),
+			})
+			return
+		}
+		request.Kind, request.Name = kind, name
+	}
+	_, err := c.remediateRequest(ctx, request, "analyzer/"+finding.Kind, nil)
+	var awaiting *awaitingApprovalError
+	if errors.As(err, &awaiting) {
+		// the finding is kept for the next reconcile, which resumes the remediation
+		c.findingsMu.Lock()
+		if _, ok := c.findings[key]; !ok {
+			c.findings[key] = finding
+		}
+		c.findingsMu.Unlock()
+		c.queue.AddAfter(key, approvalPollInterval)
+		return
+	}
+	if err != nil {
+		c.Logger.Error("failed to remediate the finding", zap.Error(err), zap.String("kind", finding.Kind),
+			zap.String("name", finding.Namespace+"/"+finding.Name))
+	}
+}
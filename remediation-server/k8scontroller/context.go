@@ -0,0 +1,119 @@
+package k8scontroller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VedRatan/remediation-server/handlers"
+	"github.com/VedRatan/remediation-server/prompt"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// logTailLines bounds the logs fetched for a container, the prompt keeps a few KB of them only. It leaves room for
+// a stack trace starting well before the last lines.
+const logTailLines = 1000
+
+// collectEvents returns the events of the given object, oldest first, formatted for the prompt. An empty
+// eventType returns the events of all types.
+func (c *controller) collectEvents(ctx context.Context, namespace, kind, name, eventType string) ([]string, error) {
+	selector := client.MatchingFields{
+		"involvedObject.kind": kind,
+		"involvedObject.name": name,
+	}
+	if eventType != "" {
+		selector["type"] = eventType
+	}
+	var events corev1.EventList
+	if err := c.clientset.List(ctx, &events, client.InNamespace(namespace), selector); err != nil {
+		return nil, fmt.Errorf("failed to list events of %s %s/%s: %v", kind, namespace, name, err)
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return eventTime(events.Items[i]).Before(eventTime(events.Items[j]))
+	})
+	lines := make([]string, 0, len(events.Items))
+	for _, event := range events.Items {
+		line := fmt.Sprintf("%s %s: %s", event.Type, event.Reason, event.Message)
+		if event.Count > 1 {
+			line = fmt.Sprintf("%s (x%d)", line, event.Count)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func eventTime(event corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// ownerOf returns the controller of the object in Kind/name form
+func ownerOf(obj metav1.Object) string {
+	if ref := metav1.GetControllerOf(obj); ref != nil {
+		return ref.Kind + "/" + ref.Name
+	}
+	return ""
+}
+
+// collectWarningEvents returns the Warning events of the pod and of its owner, most recent ones within the budget
+func (c *controller) collectWarningEvents(ctx context.Context, pod *corev1.Pod) []string {
+	events, err := c.collectEvents(ctx, pod.Namespace, "Pod", pod.Name, corev1.EventTypeWarning)
+	if err != nil {
+		c.Logger.Error("failed to collect events of the faulty pod", zap.Error(err))
+	}
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		ownerEvents, err := c.collectEvents(ctx, pod.Namespace, ref.Kind, ref.Name, corev1.EventTypeWarning)
+		if err != nil {
+			c.Logger.Error("failed to collect events of the owner of the faulty pod", zap.Error(err))
+		}
+		for _, event := range ownerEvents {
+			events = append(events, ref.Kind+"/"+ref.Name+": "+event)
+		}
+	}
+	return prompt.TruncateLines(events, types.PromptEventsBudget)
+}
+
+// collectContainerLogs returns the logs of the containers that are failing, the logs of the previous instance
+// are included for the containers that restarted as they usually hold the crash
+func (c *controller) collectContainerLogs(ctx context.Context, pod *corev1.Pod) []prompt.ContainerLogs {
+	var logs []prompt.ContainerLogs
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Ready && status.RestartCount == 0 {
+			continue
+		}
+		if status.RestartCount > 0 || status.LastTerminationState.Terminated != nil {
+			logs = c.appendLogs(ctx, logs, pod, status.Name, true)
+		}
+		if status.State.Waiting == nil {
+			logs = c.appendLogs(ctx, logs, pod, status.Name, false)
+		}
+	}
+	return logs
+}
+
+func (c *controller) appendLogs(ctx context.Context, logs []prompt.ContainerLogs, pod *corev1.Pod, container string, previous bool) []prompt.ContainerLogs {
+	text, err := handlers.GetPodLogs(ctx, pod.Namespace, pod.Name, handlers.LogOptions{Container: container, Previous: previous, TailLines: logTailLines})
+	if err != nil {
+		c.Logger.Info("failed to get logs of the faulty pod", zap.Error(err), zap.String("container", container), zap.Bool("previous", previous))
+		return logs
+	}
+	if text == "" {
+		return logs
+	}
+	return append(logs, prompt.ContainerLogs{
+		Container: container,
+		Previous:  previous,
+		Logs:      prompt.Truncate(text, types.PromptLogBudget),
+	})
+}
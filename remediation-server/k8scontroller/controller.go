@@ -3,18 +3,33 @@ package k8scontroller
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	customlogger "github.com/VedRatan/k8swatchdog/logger"
+	"github.com/VedRatan/k8swatchdog/sanitize"
 	"github.com/VedRatan/remediation-server/ai"
+	"github.com/VedRatan/remediation-server/analyzer"
+	"github.com/VedRatan/remediation-server/detector"
 	"github.com/VedRatan/remediation-server/handlers"
 	"github.com/VedRatan/remediation-server/k8s"
+	"github.com/VedRatan/remediation-server/notify"
+	"github.com/VedRatan/remediation-server/policy"
+	"github.com/VedRatan/remediation-server/prompt"
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/redact"
 	"github.com/VedRatan/remediation-server/types"
 	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -23,10 +38,14 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// errResultDeleted cancels the reconcile of a Result deleted meanwhile
+var errResultDeleted = errors.New("the Result was deleted")
+
 var (
 	factory   dynamicinformer.DynamicSharedInformerFactory
 	resultGVR = schema.GroupVersionResource{
@@ -34,18 +53,50 @@ var (
 		Version:  "v1alpha1",
 		Resource: "results",
 	}
-	extraprompt = "Generate a remediated Kubernetes Pod YAML manifest for above faulty Pod. Generate a valid pod YAML with no extra fields, don't change the metadata of the pod. Ensure the YAML is valid, properly formatted, and does not include any unnecessary fields, comments, or text explanations."
 )
 
 type controller struct {
-	clientset         client.Client
-	resLister         cache.GenericLister
-	queue             workqueue.TypedRateLimitingInterface[any]
-	wg                wait.Group
-	aiClient          ai.AIClient
-	Informer          cache.SharedIndexInformer
+	clientset      client.Client
+	resLister      cache.GenericLister
+	queue          workqueue.TypedRateLimitingInterface[any]
+	wg             wait.Group
+	aiClient       *ai.FallbackClient
+	recorder       *records.Recorder
+	Prompts        *prompt.Store
+	redactor       *redact.Redactor
+	whitelist      *policy.Whitelist
+	allowedActions []string
+	risk           *policy.RiskScorer
+	notifier       *notify.Notifier
+	// events records the Kubernetes events of the remediations on their target and Result
+	events           record.EventRecorder
+	eventBroadcaster record.EventBroadcaster
+	detector         *detector.Detector
+	analyzers        []analyzer.Analyzer
+	// ignoreNamespaces are ignored by the detector and the analyzers
+	ignoreNamespaces []string
+	// analyzed maps the findings of the previous analysis to their errors, only the analysis loop uses it
+	analyzed map[analyzer.Key]string
+	// findings holds the findings of the analyzers until their key is reconciled
+	findings   map[analyzer.Key]analyzer.Finding
+	findingsMu sync.Mutex
+	// inflight maps the namespace/name of the Results being reconciled to the cancellation of their reconcile
+	inflight   map[string]context.CancelCauseFunc
+	inflightMu sync.Mutex
+	// active holds the Kind/namespace/name of the objects being remediated
+	active   map[string]bool
+	activeMu sync.Mutex
+	Informer cache.SharedIndexInformer
+	// Informers are the informers to run in the k8s-controller mode, the Result informer and the detector ones
+	Informers         []cache.SharedIndexInformer
 	eventRegistration cache.ResourceEventHandlerRegistration
-	Logger            *zap.Logger
+	// repairAttempts maps the namespace/name of the Results to the ai calls made for their current errors
+	repairAttempts   map[string]int
+	repairAttemptsMu sync.Mutex
+	// pending maps the namespace/name of the pods to their remediation awaiting its approval
+	pending   map[string]*remediationRun
+	pendingMu sync.Mutex
+	Logger    *zap.Logger
 }
 
 func K8sGptResultInformer() cache.SharedIndexInformer {
@@ -63,23 +114,62 @@ func NewController(client client.Client) *controller {
 	resInformer := K8sGptResultInformer()
 	resLister := K8sGptLister()
 
-	aiClient, err := ai.GetAiClient(types.AiAgent)
+	logger, err := customlogger.NewLogger("remediation-server")
+	if err != nil {
+		fmt.Println("Error initializing logger:", err)
+		os.Exit(1)
+	}
+
+	aiClient, err := ai.NewFallbackClient(ai.ParseBackends(types.AiAgent), logger)
 	if err != nil {
 		fmt.Printf("failed to get AI client: %v", err)
 		os.Exit(1)
 	}
+
+	redactor, err := newRedactor()
+	if err != nil {
+		fmt.Printf("failed to set up the redaction: %v", err)
+		os.Exit(1)
+	}
+	whitelist, err := policy.NewWhitelist(strings.Split(types.AllowedChanges, ","))
+	if err != nil {
+		fmt.Printf("failed to set up the allowed changes: %v", err)
+		os.Exit(1)
+	}
+	risk, err := newRiskScorer()
+	if err != nil {
+		fmt.Printf("failed to set up the risk scoring: %v", err)
+		os.Exit(1)
+	}
+	eventBroadcaster := newEventBroadcaster()
 	c := &controller{
-		clientset: client,
-		resLister: resLister,
-		Informer:  resInformer,
-		wg:        wait.Group{},
-		aiClient:  aiClient,
-		queue:     workqueue.NewTypedRateLimitingQueue[any](workqueue.DefaultTypedControllerRateLimiter[any]()),
+		clientset:        client,
+		resLister:        resLister,
+		Informer:         resInformer,
+		wg:               wait.Group{},
+		aiClient:         aiClient,
+		recorder:         records.NewRecorder(client),
+		Prompts:          prompt.NewStore(logger),
+		repairAttempts:   map[string]int{},
+		redactor:         redactor,
+		whitelist:        whitelist,
+		allowedActions:   parseList(types.AllowedActions),
+		risk:             risk,
+		notifier:         notify.NewNotifier(types.NotifyWebhook, logger),
+		events:           eventBroadcaster.NewRecorder(client.Scheme(), corev1.EventSource{Component: "remediation-server"}),
+		eventBroadcaster: eventBroadcaster,
+		findings:         map[analyzer.Key]analyzer.Finding{},
+		inflight:         map[string]context.CancelCauseFunc{},
+		active:           map[string]bool{},
+		pending:          map[string]*remediationRun{},
+		queue:            workqueue.NewTypedRateLimitingQueue[any](workqueue.DefaultTypedControllerRateLimiter[any]()),
+		Logger:           logger,
 	}
 
 	eventRegistration, err := resInformer.AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
 			AddFunc:    c.handleAdd,
+			UpdateFunc: c.handleUpdate,
 			DeleteFunc: c.handleDel,
 		},
 	)
@@ -88,14 +178,30 @@ func NewController(client client.Client) *controller {
 		os.Exit(1)
 	}
 
-	logger, err := customlogger.NewLogger("remediation-server")
-	if err != nil {
-		fmt.Println("Error initializing logger:", err)
-		os.Exit(1)
+	c.eventRegistration = eventRegistration
+	if types.WatchResults {
+		c.Informers = append(c.Informers, resInformer)
 	}
 
-	c.eventRegistration = eventRegistration
-	c.Logger = logger
+	c.ignoreNamespaces = parseList(types.DetectIgnoreNamespaces)
+	if types.SandboxNamespace != "" {
+		c.ignoreNamespaces = append(c.ignoreNamespaces, types.SandboxNamespace)
+	}
+	if types.DetectEvents {
+		c.detector = detector.New(c.queue, detector.Config{Debounce: types.DetectDebounce, IgnoreNamespaces: c.ignoreNamespaces}, logger)
+		informers, err := c.detector.Register(factory)
+		if err != nil {
+			fmt.Printf("failed to set up the detector: %v", err)
+			os.Exit(1)
+		}
+		c.Informers = append(c.Informers, informers...)
+	}
+	if types.AnalyzeInterval > 0 {
+		if c.analyzers, err = analyzer.Select(parseList(types.Analyzers)); err != nil {
+			fmt.Printf("failed to set up the analyzers: %v", err)
+			os.Exit(1)
+		}
+	}
 
 	return c
 }
@@ -104,15 +210,28 @@ func (c *controller) Start(ctx context.Context) {
 	if c.resLister == nil {
 		return
 	}
-	c.wg.StartWithContext(ctx, func(ctx context.Context) {
-		defer c.Logger.Info("worker stopped")
-		c.Logger.Info("worker starting ....")
-		wait.UntilWithContext(ctx, c.worker, 1*time.Second)
-	})
+	for i := 0; i < types.Workers; i++ {
+		c.wg.StartWithContext(ctx, func(ctx context.Context) {
+			defer c.Logger.Info("worker stopped", zap.Int("worker", i))
+			c.Logger.Info("worker starting ....", zap.Int("worker", i))
+			wait.UntilWithContext(ctx, c.worker, 1*time.Second)
+		})
+	}
+	if len(c.analyzers) > 0 {
+		c.wg.StartWithContext(ctx, func(ctx context.Context) {
+			c.Logger.Info("analyzers starting ....", zap.Duration("interval", types.AnalyzeInterval))
+			wait.UntilWithContext(ctx, c.runAnalyzers, types.AnalyzeInterval)
+		})
+	}
 }
 
 func (c *controller) Stop() {
 	defer c.Logger.Info("queue stopped")
+	// the events are flushed once the workers are done, they emit the last events of their remediations
+	defer c.FlushEvents()
+	// the remediations awaiting their approval are started over, ex: by the new leader
+	defer c.cancelPending(context.Background(), "the remediation-server stopped while the remediation awaited its approval",
+		func(*records.Remediation) bool { return true })
 	defer c.wg.Wait()
 	defer c.Logger.Sync() //nolint:errcheck
 	// Unregister the event handlers
@@ -121,6 +240,11 @@ func (c *controller) Stop() {
 	c.queue.ShutDown()
 }
 
+// FlushEvents sends the pending events and stops the event recorder, it is called once no remediation is running
+func (c *controller) FlushEvents() {
+	c.eventBroadcaster.Shutdown()
+}
+
 func (c *controller) UnregisterEventHandlers() {
 	if err := c.Informer.RemoveEventHandler(c.eventRegistration); err != nil {
 		c.Logger.Error("error removing event handlers:", zap.Error(err))
@@ -153,9 +277,18 @@ func (c *controller) processItem(ctx context.Context) bool {
 }
 
 func (c *controller) reconcile(ctx context.Context, item any) error {
-	key, err := cache.MetaNamespaceKeyFunc(item)
-	if err != nil {
-		c.Logger.Error("error getting key from cache", zap.Error(err))
+	if finding, ok := item.(detector.Finding); ok {
+		c.remediateFinding(ctx, finding)
+		return nil
+	}
+	if key, ok := item.(analyzer.Key); ok {
+		c.remediateAnalysis(ctx, key)
+		return nil
+	}
+
+	key, ok := item.(string)
+	if !ok {
+		c.Logger.Error("unexpected item in the queue", zap.Any("item", item))
 		return nil
 	}
 
@@ -165,13 +298,47 @@ func (c *controller) reconcile(ctx context.Context, item any) error {
 		return nil
 	}
 
-	_, err = c.resLister.ByNamespace(ns).Get(name)
+	// a Result deleted while queued is dropped
+	obj, err := c.resLister.ByNamespace(ns).Get(name)
+	if apierrors.IsNotFound(err) {
+		c.Logger.Info("the Result is gone, nothing to remediate", zap.String("name", name), zap.String("namespace", ns))
+		c.cancelPending(ctx, "the Result was deleted while the remediation awaited its approval", func(record *records.Remediation) bool {
+			return record.Spec.Result == key
+		})
+		return nil
+	}
 	if err != nil {
 		c.Logger.Error("error getting result obj", zap.Error(err), zap.String("name", name), zap.String("namespace", ns))
 		return nil
 	}
 
-	err = c.createRemediationRequest(ns, name)
+	// the reconcile is cancelled if the Result is deleted meanwhile
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	c.inflightMu.Lock()
+	c.inflight[key] = cancel
+	c.inflightMu.Unlock()
+	defer func() {
+		c.inflightMu.Lock()
+		delete(c.inflight, key)
+		c.inflightMu.Unlock()
+	}()
+
+	err = c.createRemediationRequest(ctx, obj, ns, name)
+	if errors.Is(context.Cause(ctx), errResultDeleted) {
+		c.Logger.Info("the Result was deleted, its remediation was cancelled", zap.String("name", name), zap.String("namespace", ns))
+		return nil
+	}
+	var cooling *coolDownError
+	if errors.As(err, &cooling) {
+		c.queue.AddAfter(key, cooling.remaining)
+		return nil
+	}
+	var awaiting *awaitingApprovalError
+	if errors.As(err, &awaiting) {
+		c.queue.AddAfter(key, approvalPollInterval)
+		return nil
+	}
 	if err != nil {
 		c.Logger.Error("error creating remediation request to k8s-agent", zap.Error(err), zap.String("name", name), zap.String("namespace", ns))
 		return err
@@ -179,20 +346,13 @@ func (c *controller) reconcile(ctx context.Context, item any) error {
 	return nil
 }
 
-func (c *controller) createRemediationRequest(ns string, name string) error {
-	ctx := context.Background()
+func (c *controller) createRemediationRequest(ctx context.Context, obj runtime.Object, ns string, name string) error {
 	var result k8sgptv1alpha1.Result
 
-	// Fetch and process the object
-	obj, err := c.resLister.ByNamespace(ns).Get(name)
-	if err != nil {
-		c.Logger.Error("error getting result obj", zap.Error(err), zap.String("name", name), zap.String("namespace", ns))
-		return err
-	}
-
 	unstructureObj, ok := obj.(*unstructured.Unstructured)
 	if !ok {
-		c.Logger.Error("failed to convert runtime.Object to *unstructured.Unstructured", zap.Error(err), zap.String("name", name), zap.String("namespace", ns))
+		c.Logger.Error("failed to convert runtime.Object to *unstructured.Unstructured", zap.String("name", name), zap.String("namespace", ns))
+		return fmt.Errorf("unexpected type %T of the Result %s/%s", obj, ns, name)
 	}
 
 	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructureObj.Object, &result); err != nil {
@@ -200,59 +360,336 @@ func (c *controller) createRemediationRequest(ns string, name string) error {
 		return err
 	}
 
-	prompt := result.Spec.Details
+	if processed(&result) {
+		c.Logger.Info("the errors of the Result have been remediated already", zap.String("name", name), zap.String("namespace", ns))
+		return nil
+	}
+	record, err := c.remediateResult(ctx, &result, ns+"/"+name, "", func(recordKey string) {
+		recordNs, recordName, _ := strings.Cut(recordKey, "/")
+		started := &records.Remediation{ObjectMeta: metav1.ObjectMeta{Namespace: recordNs, Name: recordName}}
+		started.Status.Phase = records.PhaseInProgress
+		if err := c.writeBack(ctx, &result, started); err != nil {
+			c.Logger.Error("failed to report the remediation on the Result", zap.Error(err))
+		}
+	})
+	if errors.Is(context.Cause(ctx), errResultDeleted) || (err != nil && record == nil) {
+		return err
+	}
+	if record != nil {
+		if err := c.writeBack(context.WithoutCancel(ctx), &result, record); err != nil {
+			c.Logger.Error("failed to report the remediation on the Result", zap.Error(err))
+		}
+	}
+	var awaiting *awaitingApprovalError
+	if ctx.Err() != nil || errors.As(err, &awaiting) {
+		// the remediation was interrupted, ex: on shutdown, or awaits its approval, the Result is remediated again by
+		// the next reconcile
+		return err
+	}
+	// a remediation that was attempted is not retried for the same errors of the Result, whatever its outcome
+	if markErr := c.markProcessed(ctx, &result); markErr != nil {
+		c.Logger.Error("failed to record the processed errors", zap.Error(markErr))
+	}
+	return err
+}
+
+// remediateFinding remediates a pod found faulty by the detector, the reasons collected during the debounce window
+// take the place of the details of a k8sgpt Result. A failure is not retried, the detector enqueues the pod again
+// on its next Warning event or failing transition.
+func (c *controller) remediateFinding(ctx context.Context, finding detector.Finding) {
+	reasons := c.detector.Take(finding)
+	target := finding.Namespace + "/" + finding.Name
+	if len(reasons) == 0 && !c.awaitingApproval(target) {
+		return
+	}
+	result := &k8sgptv1alpha1.Result{Spec: k8sgptv1alpha1.ResultSpec{
+		Kind:    "Pod",
+		Name:    target,
+		Details: detector.Details(finding, reasons),
+	}}
+	_, err := c.remediateResult(ctx, result, "", "detector", nil)
+	var awaiting *awaitingApprovalError
+	if errors.As(err, &awaiting) {
+		c.queue.AddAfter(finding, approvalPollInterval)
+		return
+	}
+	if err != nil {
+		c.Logger.Error("failed to remediate the detected pod", zap.Error(err), zap.String("pod", result.Spec.Name))
+	}
+}
+
+// Remediate runs the remediation pipeline for an object named in a request of the server mode rather than by a
+// k8sgpt Result, the problem of the request takes the place of the details of the Result in the prompt. A request
+// naming a workload remediates its first pod which is not Ready. started
+// is called with the namespace/name of the remediation record once it is created. The finished record is
+// returned, nil if the object did not need a remediation. The jobs of the server mode do not hold a worker, a
+// remediation awaiting its approval is resumed every approvalPollInterval until it is done.
+func (c *controller) Remediate(ctx context.Context, request types.ObjectRequest, source string, started func(record string)) (*records.Remediation, error) {
+	for {
+		record, err := c.remediateRequest(ctx, request, source, started)
+		var awaiting *awaitingApprovalError
+		if !errors.As(err, &awaiting) {
+			return record, err
+		}
+		started = nil
+		select {
+		case <-ctx.Done():
+			c.cancelPending(context.WithoutCancel(ctx), fmt.Sprintf("%v while the remediation awaited its approval", context.Cause(ctx)),
+				func(pending *records.Remediation) bool { return pending == record })
+			return record, ctx.Err()
+		case <-time.After(approvalPollInterval):
+		}
+	}
+}
+
+// remediateRequest runs a single pass of Remediate, a remediation awaiting its approval returns an
+// *awaitingApprovalError
+func (c *controller) remediateRequest(ctx context.Context, request types.ObjectRequest, source string, started func(record string)) (*records.Remediation, error) {
+	podName := request.Name
+	if request.Kind != "Pod" {
+		var err error
+		if podName, err = c.faultyPodOf(ctx, request.Kind, request.Namespace, request.Name); err != nil {
+			return nil, err
+		}
+	}
+	result := &k8sgptv1alpha1.Result{Spec: k8sgptv1alpha1.ResultSpec{
+		Kind:    "Pod",
+		Name:    request.Namespace + "/" + podName,
+		Details: request.Problem,
+	}}
+	return c.remediateResult(ctx, result, "", source, started)
+}
+
+// remediateResult generates, validates, applies and verifies the remediation of the faulty object of the Result.
+// resultName is the namespace/name of the Result and source identifies the other requesters, both are recorded.
+func (c *controller) remediateResult(ctx context.Context, result *k8sgptv1alpha1.Result, resultName, source string, started func(record string)) (*records.Remediation, error) {
 	nsName := result.Spec.Name
 	podNs, podName, err := cache.SplitMetaNamespaceKey(nsName)
 	if err != nil {
 		c.Logger.Error("error splitting key into namespace and name", zap.Error(err))
-		return err
+		return nil, err
 	}
 
-	if err := handlers.VerifyPodStatus(podNs, podName, false); err == nil {
+	if err := handlers.VerifyPodStatus(ctx, podNs, podName); err == nil {
 		c.Logger.Info("pod is already in running state, no need to remediate", zap.String("name", podName), zap.String("namespace", podNs))
-		return nil
+		c.cancelPending(ctx, "the pod became Ready while the remediation awaited its approval", func(record *records.Remediation) bool {
+			return record.Spec.Target == nsName
+		})
+		return nil, nil
+	}
+
+	// the work is keyed by the target, several Results or requesters can point at the same pod
+	release, run, err := c.claim(ctx, "Pod", podNs, podName)
+	if err != nil {
+		c.Logger.Info("remediation postponed", zap.Error(err))
+		return nil, err
+	}
+	defer release()
+	if run != nil {
+		// the remediation awaiting its approval picks up where it stopped
+		return run.record, c.resumeRun(ctx, run)
 	}
 
 	var pod corev1.Pod
 	if err := c.clientset.Get(ctx, apitypes.NamespacedName{Namespace: podNs, Name: podName}, &pod); err != nil {
 		c.Logger.Error("failed to get pod", zap.Error(err), zap.String("name", podName), zap.String("namespace", podNs))
-		return err
+		return nil, err
 	}
 
 	c.Logger.Info("fetched the faulty pod", zap.String("name", nsName))
+	// Only the desired state of the pod is sent, with its secrets masked before anything leaves the cluster
+	secrets := c.redactor.NewSession()
 	// Convert the Pod object to YAML
 	serializer := jsonApiMachinery.NewSerializerWithOptions(jsonApiMachinery.DefaultMetaFactory, nil, nil, jsonApiMachinery.SerializerOptions{Yaml: true})
 	var podYAML bytes.Buffer
-	if err := serializer.Encode(&pod, &podYAML); err != nil {
+	if err := serializer.Encode(secrets.RedactPod(sanitize.Pod(&pod)), &podYAML); err != nil {
 		c.Logger.Error("failed to encode pod to YAML", zap.Error(err))
 	}
 
-	// Construct the prompt for the AI agent
-	aiPrompt := fmt.Sprintf("%s\n\nPod YAML:\n%s\n\n%s", prompt, podYAML.String(), extraprompt)
+	workload, err := c.workloadOf(ctx, &pod)
+	if err != nil {
+		// the workload actions are rejected without a workload, the pod actions still work
+		c.Logger.Error("failed to get the workload of the pod", zap.Error(err), zap.String("pod", nsName))
+	}
+	if workload != nil {
+		// another pod of the workload may be remediated meanwhile, both could patch the workload
+		release, err := c.lock(workload.Kind + "/" + workload.Namespace + "/" + workload.Name)
+		if err != nil {
+			c.Logger.Info("remediation postponed", zap.Error(err))
+			return nil, err
+		}
+		defer release()
+	}
+	data := prompt.Data{
+		Result:      result,
+		Kind:        "Pod",
+		Namespace:   podNs,
+		Name:        podName,
+		Object:      podYAML.String(),
+		Owner:       ownerOf(&pod),
+		Events:      c.collectWarningEvents(ctx, &pod),
+		Logs:        c.collectContainerLogs(ctx, &pod),
+		Revisions:   describeRevisions(workload),
+		Constraints: c.describeConstraints(ctx, &pod),
+	}
+	if workload != nil {
+		data.Workload = workload.Kind + "/" + workload.Name
+	}
 
-	// Call the AI client to generate content
-	remediatedYAML, err := c.aiClient.GenerateContent(ctx, aiPrompt)
+	// Construct the prompt for the AI agent
+	aiPrompt, err := c.Prompts.Render(data)
 	if err != nil {
-		c.Logger.Error("failed to generate content from AI agent", zap.Error(err))
-		return err
+		c.Logger.Error("failed to build the prompt", zap.Error(err))
+		return nil, err
 	}
+	aiPrompt = secrets.RedactText(aiPrompt)
+
+	record := &records.Remediation{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: podName + "-", Namespace: podNs},
+		Spec: records.RemediationSpec{
+			Result: resultName,
+			Source: source,
+			Kind:   "Pod",
+			Target: nsName,
+		},
+	}
+	record.Status.RedactedValues = secrets.Count()
+	// the ai calls of the previous remediations of the same errors of the Result count against its attempts
+	record.Status.Attempts = c.usedAttempts(resultName)
+	defer func() { c.recordAttempts(resultName, record.Status.Attempts) }()
+	if err := c.recorder.Start(ctx, record); err != nil {
+		c.Logger.Error("failed to record remediation", zap.Error(err), zap.String("pod", nsName))
+	}
+	c.event(ctx, record, corev1.EventTypeNormal, ReasonStarted, "K8sWatchDog started remediating the pod %s", nsName)
 
-	c.Logger.Info("got the remediation, remediating faulty pod...", zap.String("pod", nsName))
+	if started != nil && record.Name != "" {
+		started(record.Namespace + "/" + record.Name)
+	}
 
-	// Forward the remediation
-	if err := handlers.ForwardRemediation(remediatedYAML); err != nil {
-		c.Logger.Error("failed to forward remediation to k8s-agent", zap.Error(err))
-		return err
+	run = &remediationRun{
+		record:       record,
+		conversation: []types.Message{{Role: types.RoleUser, Content: aiPrompt}},
+		original:     &pod,
+		workload:     workload,
+		secrets:      secrets,
 	}
+	return record, c.runRemediation(ctx, run)
+}
 
-	c.Logger.Info("remediated faulty pod", zap.String("pod", nsName))
-	return nil
+// resumeRun resumes the remediation awaiting its approval, once the workload of its pod is locked again
+func (c *controller) resumeRun(ctx context.Context, run *remediationRun) error {
+	if workload := run.workload; workload != nil {
+		release, err := c.lock(workload.Kind + "/" + workload.Namespace + "/" + workload.Name)
+		if err != nil {
+			c.suspend(run)
+			c.Logger.Info("remediation postponed", zap.Error(err))
+			return err
+		}
+		defer release()
+	}
+	defer func() { c.recordAttempts(run.record.Spec.Result, run.record.Status.Attempts) }()
+	return c.runRemediation(ctx, run)
+}
+
+// runRemediation remediates the pod of the run, the run is suspended while it awaits its approval
+func (c *controller) runRemediation(ctx context.Context, run *remediationRun) error {
+	err := c.remediate(ctx, run)
+	var awaiting *awaitingApprovalError
+	if errors.As(err, &awaiting) {
+		c.suspend(run)
+	}
+	return err
+}
+
+// newRedactor sets up the redaction pipeline from the flags
+func newRedactor() (*redact.Redactor, error) {
+	config := redact.Config{
+		Disabled:   !types.Redact,
+		MinEntropy: types.RedactEntropy,
+	}
+	config.AnnotationKeys = parseList(types.RedactAnnotations)
+	for _, pattern := range types.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %v", pattern, err)
+		}
+		config.Patterns = append(config.Patterns, re)
+	}
+	return redact.NewRedactor(config), nil
+}
+
+// parseList splits a comma separated flag, ignoring the empty items
+func parseList(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// finishRecord moves the remediation record to its final phase, failures are only logged as the record
+// is informational and must not block the remediation itself.
+func (c *controller) finishRecord(ctx context.Context, record *records.Remediation, phase records.Phase, message string) {
+	if phase == records.PhaseFailed && ctx.Err() != nil {
+		phase, message = records.PhaseCancelled, fmt.Sprintf("%v during the remediation: %s", context.Cause(ctx), message)
+	}
+	eventType, reason, text := phaseEvent(phase, message)
+	c.event(ctx, record, eventType, reason, "%s", text)
+	if record.Name == "" {
+		return
+	}
+	// the record is still finished once the reconcile is cancelled
+	if err := c.recorder.Finish(context.WithoutCancel(ctx), record, phase, message); err != nil {
+		c.Logger.Error("failed to update remediation record", zap.Error(err))
+	}
 }
 
 func (c *controller) handleAdd(obj interface{}) {
-	c.queue.Add(obj)
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.Logger.Error("error getting key from cache", zap.Error(err))
+		return
+	}
+	c.queue.Add(key)
 }
 
+// handleUpdate enqueues the Result again when its errors changed, ex: the faulty object fails for another reason.
+// The resyncs and the status updates are ignored.
+func (c *controller) handleUpdate(oldObj, newObj interface{}) {
+	oldResult, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	newResult, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	oldErrors, _, _ := unstructured.NestedSlice(oldResult.Object, "spec", "error")
+	newErrors, _, _ := unstructured.NestedSlice(newResult.Object, "spec", "error")
+	if equality.Semantic.DeepEqual(oldErrors, newErrors) {
+		return
+	}
+	c.Logger.Info("the errors of the Result changed", zap.String("name", newResult.GetName()), zap.String("namespace", newResult.GetNamespace()))
+	c.resetAttempts(newResult.GetNamespace() + "/" + newResult.GetName())
+	c.handleAdd(newObj)
+}
+
+// handleDel cancels the in-flight reconcile of the deleted Result, k8sgpt deletes a Result once its problem went
+// away. A Result still queued is dropped when it is reconciled.
 func (c *controller) handleDel(obj interface{}) {
-	c.Logger.Info("delete was called")
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.Logger.Error("error getting key from cache", zap.Error(err))
+		return
+	}
+	c.queue.Forget(key)
+	c.resetAttempts(key)
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	if cancel, ok := c.inflight[key]; ok {
+		c.Logger.Info("the Result was deleted, cancelling its remediation", zap.String("result", key))
+		cancel(errResultDeleted)
+	}
 }
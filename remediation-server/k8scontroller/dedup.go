@@ -0,0 +1,108 @@
+package k8scontroller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/VedRatan/remediation-server/types"
+	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// processedAnnotation is set on a Result to a digest of the errors that were remediated, the Result is not
+// remediated again until k8sgpt reports other errors, ex: after a restart or a resync. The generation cannot be
+// used, the write-back of the remediation changes it.
+const processedAnnotation = "k8swatchdog.io/processed-errors"
+
+// activeRetry is the delay before an object being remediated is tried again, the cool-down applies once it is done
+const activeRetry = 30 * time.Second
+
+// coolDownError postpones the remediation of an object that is being remediated or was remediated recently
+type coolDownError struct {
+	target    string
+	reason    string
+	remaining time.Duration
+}
+
+func (e *coolDownError) Error() string {
+	return fmt.Sprintf("%s %s, it can be remediated again in %s", e.target, e.reason, e.remaining.Round(time.Second))
+}
+
+// claim reserves the target for a remediation, it fails if the target is being remediated or was remediated less
+// than types.RemediationCooldown ago. The cool-down is read from the remediation records so that it survives
+// restarts and covers every source of remediations. The run of the target awaiting its approval is returned to be
+// resumed, whatever the cool-down. The returned release has to be called once done.
+func (c *controller) claim(ctx context.Context, kind, namespace, name string) (release func(), run *remediationRun, err error) {
+	target := kind + "/" + namespace + "/" + name
+	release, err = c.lock(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if run := c.resume(namespace + "/" + name); run != nil {
+		return release, run, nil
+	}
+
+	if types.RemediationCooldown > 0 {
+		last, err := c.recorder.LastStarted(ctx, namespace, kind, namespace+"/"+name)
+		if err != nil {
+			// the records are informational, a failure to read them does not block the remediation
+			c.Logger.Error("failed to read the last remediation", zap.Error(err), zap.String("target", target))
+		} else if since := time.Since(last); since < types.RemediationCooldown {
+			release()
+			return nil, nil, &coolDownError{
+				target:    target,
+				reason:    fmt.Sprintf("was remediated %s ago", since.Round(time.Second)),
+				remaining: types.RemediationCooldown - since,
+			}
+		}
+	}
+	return release, nil, nil
+}
+
+// lock reserves the target, ex: Deployment/namespace/name, for a single worker. Two pods of a workload may both
+// patch it, so the workload is locked as well as the pod. The returned release has to be called once done.
+func (c *controller) lock(target string) (release func(), err error) {
+	c.activeMu.Lock()
+	defer c.activeMu.Unlock()
+	if c.active[target] {
+		// another source of the target, ex: a second Result of the pod, is tried again once the lock is likely released
+		return nil, &coolDownError{target: target, reason: "is already being remediated", remaining: activeRetry}
+	}
+	c.active[target] = true
+	return func() {
+		c.activeMu.Lock()
+		delete(c.active, target)
+		c.activeMu.Unlock()
+	}, nil
+}
+
+// processed tells whether the current errors of the Result have been remediated already
+func processed(result *k8sgptv1alpha1.Result) bool {
+	return result.Annotations[processedAnnotation] == errorsDigest(result)
+}
+
+// markProcessed records the errors of the Result that was remediated, as read before the remediation, on the
+// Result itself
+func (c *controller) markProcessed(ctx context.Context, result *k8sgptv1alpha1.Result) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, processedAnnotation, errorsDigest(result))
+	target := &k8sgptv1alpha1.Result{ObjectMeta: metav1.ObjectMeta{Namespace: result.Namespace, Name: result.Name}}
+	if err := c.clientset.Patch(ctx, target, client.RawPatch(apitypes.MergePatchType, []byte(patch))); err != nil {
+		return fmt.Errorf("failed to mark the Result %s/%s as processed: %v", result.Namespace, result.Name, err)
+	}
+	return nil
+}
+
+// errorsDigest identifies the errors of the Result
+func errorsDigest(result *k8sgptv1alpha1.Result) string {
+	hash := sha256.New()
+	for _, failure := range result.Spec.Error {
+		fmt.Fprintf(hash, "%s\x00", failure.Text)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
@@ -0,0 +1,115 @@
+package k8scontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/k8s"
+	"github.com/VedRatan/remediation-server/records"
+	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The reasons of the events emitted on the remediated object and its Result, the k8s-agent emits the applied and
+// rolled back events on the object it changes
+const (
+	ReasonStarted    = "RemediationStarted"
+	ReasonProposed   = "RemediationProposed"
+	ReasonRejected   = "RemediationRejected"
+	ReasonApplied    = "RemediationApplied"
+	ReasonNotReady   = "RemediationNotReady"
+	ReasonVerified   = "RemediationVerified"
+	ReasonRolledBack = "RemediationRolledBack"
+	ReasonFailed     = "RemediationFailed"
+	ReasonRefused    = "RemediationRefused"
+	ReasonCancelled  = "RemediationCancelled"
+)
+
+// maxEventMessage keeps the messages of the events short, the details are in the remediation record
+const maxEventMessage = 256
+
+// newEventBroadcaster sends the events of the remediation-server to the api server
+func newEventBroadcaster() record.EventBroadcaster {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8s.NewClientsetOrDie().CoreV1().Events("")})
+	return broadcaster
+}
+
+// event emits an event on the target of the remediation and on its Result
+func (c *controller) event(ctx context.Context, rem *records.Remediation, eventType, reason, format string, args ...any) {
+	message := truncate(fmt.Sprintf(format, args...), maxEventMessage)
+	if target := c.targetObject(ctx, rem); target != nil {
+		c.events.Event(target, eventType, reason, message)
+	}
+	c.resultEvent(ctx, rem, eventType, reason, message)
+}
+
+// resultEvent emits an event on the Result of the remediation only, if it was triggered by a Result
+func (c *controller) resultEvent(ctx context.Context, rem *records.Remediation, eventType, reason, message string) {
+	if rem.Spec.Result == "" {
+		return
+	}
+	ns, name, err := cache.SplitMetaNamespaceKey(rem.Spec.Result)
+	if err != nil {
+		return
+	}
+	var result k8sgptv1alpha1.Result
+	// the events are still emitted once the reconcile is cancelled, a deleted Result has nowhere to show them
+	if err := c.clientset.Get(context.WithoutCancel(ctx), apitypes.NamespacedName{Namespace: ns, Name: name}, &result); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			c.Logger.Error("failed to get the Result for its event", zap.Error(err), zap.String("result", rem.Spec.Result))
+		}
+		return
+	}
+	c.events.Event(&result, eventType, reason, truncate(message, maxEventMessage))
+}
+
+// targetObject returns the remediated object, or a reference to it once it has been deleted so that its events are
+// still listed by namespace and name
+func (c *controller) targetObject(ctx context.Context, rem *records.Remediation) runtime.Object {
+	ns, name, err := cache.SplitMetaNamespaceKey(rem.Spec.Target)
+	if err != nil {
+		return nil
+	}
+	ref := &corev1.ObjectReference{Kind: rem.Spec.Kind, Namespace: ns, Name: name}
+	if rem.Spec.Kind != "Pod" {
+		return ref
+	}
+	ref.APIVersion = "v1"
+	var pod corev1.Pod
+	if err := c.clientset.Get(context.WithoutCancel(ctx), apitypes.NamespacedName{Namespace: ns, Name: name}, &pod); err != nil {
+		return ref
+	}
+	return &pod
+}
+
+// phaseEvent returns the type, reason and message of the event reporting the final phase of a remediation
+func phaseEvent(phase records.Phase, message string) (eventType, reason, text string) {
+	switch phase {
+	case records.PhaseSucceeded:
+		return corev1.EventTypeNormal, ReasonVerified, "remediation verified: " + message
+	case records.PhaseEscalated:
+		return corev1.EventTypeWarning, ReasonRolledBack, "remediation escalated, " + message
+	case records.PhaseRefused:
+		return corev1.EventTypeWarning, ReasonRefused, "remediation refused: " + message
+	case records.PhaseCancelled:
+		return corev1.EventTypeNormal, ReasonCancelled, "remediation cancelled: " + message
+	}
+	return corev1.EventTypeWarning, ReasonFailed, "remediation failed: " + message
+}
+
+// truncate cuts s to at most n bytes, marking the cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n-3], "") + "..."
+}
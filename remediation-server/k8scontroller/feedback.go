@@ -0,0 +1,249 @@
+package k8scontroller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VedRatan/k8swatchdog/sanitize"
+	"github.com/VedRatan/remediation-server/handlers"
+	"github.com/VedRatan/remediation-server/plan"
+	"github.com/VedRatan/remediation-server/prompt"
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/redact"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	jsonApiMachinery "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// failureLogLines is the number of trailing log lines reported back to the model after a failed fix
+const failureLogLines = 50
+
+// remediationRun is the state of a remediation across its fix iterations, it is kept by the controller while the
+// remediation awaits its approval
+type remediationRun struct {
+	record       *records.Remediation
+	conversation []types.Message
+	original     *corev1.Pod
+	workload     *plan.Workload
+	secrets      *redact.Session
+	iteration    int
+	// applied is set once a fix has been applied, patched once the workload has been patched, the escalation then
+	// restores the workload instead of the pod
+	applied bool
+	patched *plan.Workload
+	// proposal is the validated remediation of the iteration, until it is applied
+	proposal *remediation
+}
+
+// remediate applies the proposals of the ai backend until the pod comes up Ready, or its workload completes its
+// rollout. A fix that does not work is reported back to the model with the new status, events and logs of the pod
+// so that it can try a different one. After types.MaxFixIterations failed fixes the original pod, or workload, is
+// rolled back and the remediation is escalated. A remediation awaiting its approval returns an
+// *awaitingApprovalError, it is resumed by calling remediate again with the same run.
+func (c *controller) remediate(ctx context.Context, run *remediationRun) error {
+	record, original, workload, secrets := run.record, run.original, run.workload, run.secrets
+	nsName := original.Namespace + "/" + original.Name
+	for {
+		if run.proposal == nil {
+			run.iteration++
+			record.Status.Iterations = run.iteration
+			proposal, next, err := c.generateRemediation(ctx, record, run.conversation, original, workload, secrets)
+			if err != nil {
+				c.Logger.Error("failed to generate a valid remediation", zap.Error(err), zap.Int("iteration", run.iteration))
+				if run.applied {
+					return c.escalate(ctx, record, original, run.patched, err)
+				}
+				c.finishRecord(ctx, record, records.PhaseFailed, err.Error())
+				return err
+			}
+			run.conversation = next
+			run.proposal = proposal
+			c.event(ctx, record, corev1.EventTypeNormal, ReasonProposed, "%s proposed a fix with a confidence of %.2f: %s",
+				record.Status.Backend, proposal.Confidence, proposal.Explanation)
+			record.Status.Explanation = proposal.Explanation
+			record.Status.Confidence = proposal.Confidence
+			record.Status.ChangedFields = proposal.ChangedFields
+
+			c.Logger.Info("got the remediation", zap.String("pod", nsName), zap.String("backend", record.Status.Backend),
+				zap.Int("iteration", run.iteration), zap.Float64("confidence", proposal.Confidence), zap.Strings("changedFields", proposal.ChangedFields))
+		}
+		iteration, proposal := run.iteration, run.proposal
+		if err := c.approve(ctx, run); err != nil {
+			var awaiting *awaitingApprovalError
+			var refused *refusedError
+			switch {
+			case errors.As(err, &awaiting):
+				return err
+			case run.applied:
+				return c.escalate(ctx, record, original, run.patched, err)
+			case errors.As(err, &refused):
+				c.Logger.Info("remediation refused", zap.String("pod", nsName), zap.String("reason", refused.reason))
+				c.finishRecord(ctx, record, records.PhaseRefused, refused.reason)
+				return nil
+			}
+			c.finishRecord(ctx, record, records.PhaseFailed, err.Error())
+			return err
+		}
+		run.proposal = nil
+		if len(proposal.patches) == 0 && types.SandboxNamespace != "" {
+			failure, err := c.validateInSandbox(ctx, record, proposal.Manifest, original)
+			if err != nil {
+				c.Logger.Error("remediation failed in the sandbox", zap.Error(err), zap.String("pod", nsName), zap.Int("iteration", iteration))
+				switch {
+				case run.applied:
+					return c.escalate(ctx, record, original, run.patched, err)
+				case errors.Is(err, handlers.ErrNotReady) && iteration < types.MaxFixIterations:
+					c.event(ctx, record, corev1.EventTypeWarning, ReasonNotReady, "the fix of iteration %d did not become Ready in the sandbox", iteration)
+					report := fmt.Sprintf("The fix was tried on a copy of the pod first, it did not become Ready.\n%s", failure)
+					run.conversation = append(run.conversation, types.Message{Role: types.RoleUser, Content: prompt.FixFailed(secrets.RedactText(report))})
+					continue
+				}
+				// the real pod has not been touched, there is nothing to roll back
+				c.finishRecord(ctx, record, records.PhaseFailed, fmt.Sprintf("no fix passed the sandbox after %d iterations: %v", iteration, err))
+				return nil
+			}
+		}
+		c.Logger.Info("remediating faulty pod...", zap.String("pod", nsName), zap.Int("iteration", iteration))
+
+		// Forward the remediation
+		run.applied = true
+		var err error
+		if len(proposal.patches) > 0 {
+			run.patched = workload
+			err = c.patchWorkload(ctx, workload, proposal.patches)
+		} else {
+			err = handlers.ForwardRemediation(ctx, proposal.Manifest)
+		}
+		if err == nil || errors.Is(err, handlers.ErrNotReady) {
+			// the agent reports the change on the object itself
+			c.resultEvent(ctx, record, corev1.EventTypeNormal, ReasonApplied, fmt.Sprintf("the fix of iteration %d has been applied", iteration))
+		}
+		if err == nil {
+			c.Logger.Info("remediated faulty pod", zap.String("pod", nsName), zap.Int("iteration", iteration))
+			message := "pod remediated and in Ready state"
+			if len(proposal.patches) > 0 {
+				message = fmt.Sprintf("%s %s patched and rolled out", workload.Kind, workload.Name)
+			}
+			c.finishRecord(ctx, record, records.PhaseSucceeded, message)
+			return nil
+		}
+		c.Logger.Error("failed to forward remediation to k8s-agent", zap.Error(err), zap.Int("iteration", iteration))
+		if !errors.Is(err, handlers.ErrNotReady) || iteration >= types.MaxFixIterations {
+			return c.escalate(ctx, record, original, run.patched, err)
+		}
+		c.event(ctx, record, corev1.EventTypeWarning, ReasonNotReady, "the fix of iteration %d did not work, trying another one: %v", iteration, err)
+		run.conversation = append(run.conversation, types.Message{Role: types.RoleUser, Content: prompt.FixFailed(secrets.RedactText(c.describeFailure(ctx, original.Namespace, original.Name, original)))})
+	}
+}
+
+// patchWorkload applies the patches to the workload and waits for its rollout
+func (c *controller) patchWorkload(ctx context.Context, workload *plan.Workload, patches []plan.Patch) error {
+	for _, patch := range patches {
+		if err := handlers.PatchWorkload(ctx, workload.Kind, workload.Namespace, workload.Name, patch.Type, patch.Data); err != nil {
+			return fmt.Errorf("failed to %s the %s %s: %v", patch.Action, workload.Kind, workload.Name, err)
+		}
+		c.Logger.Info("patched the workload", zap.String("action", patch.Action), zap.String("workload", workload.Kind+"/"+workload.Namespace+"/"+workload.Name))
+	}
+	if err := handlers.WaitForReady(ctx, workload.Kind, workload.Namespace, workload.Name); err != nil {
+		return fmt.Errorf("%s %s: %w", workload.Kind, workload.Name, err)
+	}
+	return nil
+}
+
+// describeFailure reports the status, events and last log lines of the remediated pod, or of its shadow pod
+func (c *controller) describeFailure(ctx context.Context, namespace, name string, original *corev1.Pod) string {
+	var report strings.Builder
+	var pod corev1.Pod
+	if err := c.clientset.Get(ctx, apitypes.NamespacedName{Namespace: namespace, Name: name}, &pod); err != nil {
+		fmt.Fprintf(&report, "The pod could not be fetched: %v\n", err)
+	} else {
+		fmt.Fprintf(&report, "Pod phase: %s\n", pod.Status.Phase)
+		for _, status := range pod.Status.ContainerStatuses {
+			fmt.Fprintf(&report, "Container %s: ready=%t restarts=%d", status.Name, status.Ready, status.RestartCount)
+			if waiting := status.State.Waiting; waiting != nil {
+				fmt.Fprintf(&report, " waiting=%s %s", waiting.Reason, waiting.Message)
+			}
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				fmt.Fprintf(&report, " lastTerminated=%s exitCode=%d", terminated.Reason, terminated.ExitCode)
+			}
+			report.WriteString("\n")
+		}
+	}
+
+	if events, err := c.collectEvents(ctx, namespace, "Pod", name, ""); err == nil && len(events) > 0 {
+		report.WriteString("\nEvents:\n")
+		report.WriteString(strings.Join(prompt.TruncateLines(events, types.PromptEventsBudget), "\n"))
+		report.WriteString("\n")
+	}
+	for _, container := range original.Spec.Containers {
+		logs, err := handlers.GetPodLogs(ctx, namespace, name, handlers.LogOptions{Container: container.Name, TailLines: failureLogLines})
+		if err != nil || logs == "" {
+			continue
+		}
+		fmt.Fprintf(&report, "\nLast log lines of container %s:\n", container.Name)
+		report.WriteString(prompt.Truncate(logs, types.PromptLogBudget))
+		report.WriteString("\n")
+	}
+	return report.String()
+}
+
+// escalate gives up on the remediation: the original pod, or the patched workload, is rolled back and the record
+// is marked as escalated for a human to look at. The Result is not retried, so nil is returned once the rollback
+// went through. Nothing is rolled back if the Result was deleted meanwhile, or if the remediation was interrupted,
+// ex: on shutdown, the fix applied may well be healthy.
+func (c *controller) escalate(ctx context.Context, record *records.Remediation, original *corev1.Pod, patched *plan.Workload, cause error) error {
+	nsName := original.Namespace + "/" + original.Name
+	if errors.Is(context.Cause(ctx), errResultDeleted) {
+		// the problem went away, the fix applied is kept
+		c.Logger.Info("the Result was deleted during the remediation, nothing is rolled back", zap.String("object", nsName))
+		c.finishRecord(ctx, record, records.PhaseCancelled, fmt.Sprintf("the Result was deleted after %d iterations: %v", record.Status.Iterations, cause))
+		return nil
+	}
+	if ctx.Err() != nil {
+		// the Result is remediated again, ex: after a restart, and picks up from the fix applied
+		c.Logger.Info("the remediation was interrupted, nothing is rolled back", zap.String("object", nsName), zap.Error(context.Cause(ctx)))
+		c.finishRecord(ctx, record, records.PhaseCancelled, fmt.Sprintf("interrupted after %d iterations: %v", record.Status.Iterations, cause))
+		return nil
+	}
+	rollback := func() error { return c.rollback(ctx, original) }
+	if patched != nil {
+		nsName = patched.Kind + "/" + patched.Namespace + "/" + patched.Name
+		rollback = func() error { return c.restoreWorkload(ctx, patched) }
+	}
+	if err := rollback(); err != nil {
+		c.Logger.Error("failed to roll back the original object", zap.Error(err), zap.String("object", nsName))
+		c.finishRecord(ctx, record, records.PhaseFailed, fmt.Sprintf("%v, rollback failed: %v", cause, err))
+		return err
+	}
+	c.Logger.Error("remediation escalated, the original object has been rolled back", zap.Error(cause), zap.String("object", nsName),
+		zap.Int("iterations", record.Status.Iterations))
+	c.finishRecord(ctx, record, records.PhaseEscalated, fmt.Sprintf("rolled back after %d iterations: %v", record.Status.Iterations, cause))
+	c.notify(ctx, record, fmt.Sprintf("remediation escalated, %s has been rolled back: %v", nsName, cause))
+	return nil
+}
+
+// rollback re-creates the original pod through the k8s-agent
+func (c *controller) rollback(ctx context.Context, original *corev1.Pod) error {
+	pod := sanitize.Pod(original)
+
+	serializer := jsonApiMachinery.NewSerializerWithOptions(jsonApiMachinery.DefaultMetaFactory, nil, nil, jsonApiMachinery.SerializerOptions{Yaml: true})
+	var podYAML bytes.Buffer
+	if err := serializer.Encode(pod, &podYAML); err != nil {
+		return fmt.Errorf("failed to encode pod to YAML: %v", err)
+	}
+	return handlers.RollbackPod(ctx, podYAML.String())
+}
+
+// restoreWorkload patches the workload back to the template and replicas it had before the remediation
+func (c *controller) restoreWorkload(ctx context.Context, workload *plan.Workload) error {
+	patch, err := plan.RestorePatch(workload)
+	if err != nil {
+		return err
+	}
+	return handlers.RollbackWorkload(ctx, workload.Kind, workload.Namespace, workload.Name, patch.Type, patch.Data)
+}
@@ -0,0 +1,50 @@
+package k8scontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/VedRatan/remediation-server/quota"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// namespaceConstraints lists the ResourceQuotas and LimitRanges of the namespace
+func (c *controller) namespaceConstraints(ctx context.Context, namespace string) ([]corev1.ResourceQuota, []corev1.LimitRange, error) {
+	var quotas corev1.ResourceQuotaList
+	if err := c.clientset.List(ctx, &quotas, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("failed to list the resource quotas: %v", err)
+	}
+	var limitRanges corev1.LimitRangeList
+	if err := c.clientset.List(ctx, &limitRanges, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("failed to list the limit ranges: %v", err)
+	}
+	return quotas.Items, limitRanges.Items, nil
+}
+
+// describeConstraints returns the resource constraints of the namespace of the pod for the prompt
+func (c *controller) describeConstraints(ctx context.Context, pod *corev1.Pod) []string {
+	quotas, limitRanges, err := c.namespaceConstraints(ctx, pod.Namespace)
+	if err != nil {
+		c.Logger.Error("failed to collect the resource constraints", zap.Error(err), zap.String("namespace", pod.Namespace))
+		return nil
+	}
+	return quota.Describe(pod, quotas, limitRanges)
+}
+
+// checkQuota rejects a remediated pod which would be refused by the ResourceQuotas or LimitRanges of its namespace
+// once the original pod is deleted, the constraints it violates are fed back to the model
+func (c *controller) checkQuota(ctx context.Context, pod, original *corev1.Pod) error {
+	quotas, limitRanges, err := c.namespaceConstraints(ctx, original.Namespace)
+	if err != nil {
+		return err
+	}
+	err = quota.Check(pod, original, quotas, limitRanges)
+	var violation *quota.ViolationError
+	if errors.As(err, &violation) {
+		return &validationError{reason: violation.Error()}
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package k8scontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VedRatan/k8swatchdog/sanitize"
+	"github.com/VedRatan/remediation-server/ai"
+	"github.com/VedRatan/remediation-server/handlers"
+	"github.com/VedRatan/remediation-server/plan"
+	"github.com/VedRatan/remediation-server/policy"
+	"github.com/VedRatan/remediation-server/prompt"
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/redact"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// validationError is a problem with the proposal of the ai backend, it is fed back to the model so that it
+// can correct its output
+type validationError struct {
+	reason string
+}
+
+func (e *validationError) Error() string {
+	return e.reason
+}
+
+// remediation is a validated proposal: the manifest replacing the faulty pod, or the patches of its workload
+type remediation struct {
+	*types.Proposal
+	patches []plan.Patch
+}
+
+// generateRemediation asks the ai backends for a remediation and validates it. Rejected proposals are sent
+// back to the model as a follow-up turn until a valid one is produced, types.MaxRepairAttempts times at most, or
+// the attempt or token budget of the Result is exhausted. The conversation is returned along with the proposal, ending with the accepted reply.
+func (c *controller) generateRemediation(ctx context.Context, record *records.Remediation, conversation []types.Message, original *corev1.Pod, workload *plan.Workload, secrets *redact.Session) (*remediation, []types.Message, error) {
+	for attempt := 1; ; attempt++ {
+		// the attempts of the Result are counted across its fix iterations and retries, see repairAttempts
+		if types.MaxAttemptsPerResult > 0 && record.Status.Attempts >= types.MaxAttemptsPerResult {
+			return nil, nil, fmt.Errorf("the %d ai calls allowed for the Result have been used", types.MaxAttemptsPerResult)
+		}
+		if types.MaxTokensPerResult > 0 && record.Status.TokensUsed >= types.MaxTokensPerResult {
+			return nil, nil, fmt.Errorf("token budget of %d exhausted after %d attempts", types.MaxTokensPerResult, record.Status.Attempts)
+		}
+		generation, err := c.aiClient.Generate(ctx, conversation)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate content from AI agent: %w", err)
+		}
+		record.Status.Attempts++
+		record.Status.TokensUsed += generation.Tokens
+		record.Status.Backend = generation.Backend
+		conversation = append(conversation, types.Message{Role: types.RoleAssistant, Content: generation.Content})
+
+		validated, err := c.validateProposal(ctx, record, generation.Content, original, workload, secrets)
+		if err == nil {
+			return validated, conversation, nil
+		}
+		var invalid *validationError
+		if !errors.As(err, &invalid) {
+			return nil, nil, err
+		}
+
+		c.Logger.Info("ai proposal rejected", zap.String("pod", original.Namespace+"/"+original.Name), zap.String("backend", generation.Backend),
+			zap.Int("attempt", attempt), zap.Int("tokens", record.Status.TokensUsed), zap.String("reason", invalid.reason))
+		c.event(ctx, record, corev1.EventTypeWarning, ReasonRejected, "the proposal of %s was rejected: %s", generation.Backend, secrets.RedactText(invalid.reason))
+		if attempt >= types.MaxRepairAttempts {
+			return nil, nil, fmt.Errorf("no valid remediation after %d attempts, last error: %w", attempt, err)
+		}
+		conversation = append(conversation, types.Message{Role: types.RoleUser, Content: secrets.RedactText(prompt.Repair(invalid.reason))})
+	}
+}
+
+// validateProposal parses the reply of the ai backend and validates its plan, a *validationError describes why
+// it is not valid. The workload actions become patches of the workload, the pod actions are rendered into a
+// manifest, which goes through the checks of validateManifest.
+func (c *controller) validateProposal(ctx context.Context, record *records.Remediation, content string, original *corev1.Pod, workload *plan.Workload, secrets *redact.Session) (*remediation, error) {
+	proposal, err := ai.ParseProposal(content)
+	if err != nil {
+		return nil, &validationError{reason: err.Error()}
+	}
+	if len(proposal.Actions) == 0 {
+		// a reply with a manifest instead of a plan, from a model that ignored the JSON contract
+		if err := c.validateManifest(ctx, record, proposal, original, secrets); err != nil {
+			return nil, err
+		}
+		return &remediation{Proposal: proposal}, nil
+	}
+
+	podActions, workloadActions, err := plan.Split(proposal.Actions, c.allowedActions)
+	if err != nil {
+		return nil, &validationError{reason: err.Error()}
+	}
+	if len(workloadActions) > 0 {
+		patches, err := plan.WorkloadPatches(workload, workloadActions, time.Now())
+		if err != nil {
+			return nil, &validationError{reason: err.Error()}
+		}
+		var changes, templateChanges []policy.Change
+		for _, patch := range patches {
+			changes = append(changes, patch.Changes...)
+			templateChanges = append(templateChanges, patch.TemplateChanges...)
+		}
+		// the pod template only changes with a revision, scale and restart leave it as is and are gated by the allowed
+		// actions. A revision replaces the whole template, it cannot be pruned so it is rejected in both modes.
+		if _, disallowed := c.whitelist.Partition(templateChanges); len(disallowed) > 0 {
+			return nil, &validationError{reason: fmt.Sprintf("the plan changes fields of the pod template that must not be changed: %s, only these may change: %s",
+				strings.Join(policy.Paths(disallowed), ", "), types.AllowedChanges)}
+		}
+		c.assess(record, proposal, workload.Namespace, append(changes, templateChanges...), nil, secrets)
+		return &remediation{Proposal: proposal, patches: patches}, nil
+	}
+
+	pod, err := plan.ApplyToPod(sanitize.Pod(original), podActions)
+	if err != nil {
+		return nil, &validationError{reason: err.Error()}
+	}
+	pod.APIVersion, pod.Kind = "v1", "Pod"
+	manifest, err := yaml.Marshal(pod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the remediated pod: %v", err)
+	}
+	proposal.Manifest = string(manifest)
+	if err := c.validateManifest(ctx, record, proposal, original, secrets); err != nil {
+		return nil, err
+	}
+	return &remediation{Proposal: proposal}, nil
+}
+
+// validateManifest restores the redacted values into the manifest of the proposal and checks that it is a valid
+// replacement of the original pod whose changes are allowed. In prune mode the disallowed changes are dropped from
+// the manifest and recorded.
+func (c *controller) validateManifest(ctx context.Context, record *records.Remediation, proposal *types.Proposal, original *corev1.Pod, secrets *redact.Session) error {
+	var err error
+	if proposal.Manifest, err = secrets.Restore(proposal.Manifest); err != nil {
+		return &validationError{reason: err.Error()}
+	}
+
+	var pod corev1.Pod
+	if err := yaml.UnmarshalStrict([]byte(proposal.Manifest), &pod); err != nil {
+		return &validationError{reason: fmt.Sprintf("the manifest is not a valid Pod: %v", err)}
+	}
+	if pod.Kind != "Pod" {
+		return &validationError{reason: fmt.Sprintf("the manifest must be of kind Pod, got %q", pod.Kind)}
+	}
+	if pod.Name != original.Name || pod.Namespace != original.Namespace {
+		return &validationError{reason: fmt.Sprintf("the manifest must keep the pod name %q and namespace %q, got %q and %q",
+			original.Name, original.Namespace, pod.Name, pod.Namespace)}
+	}
+
+	// the changes are computed on the dry-run pod, so that the fields the model left out and the api server
+	// defaults are not mistaken for changes
+	created, err := dryRun(ctx, proposal.Manifest, original)
+	if err != nil {
+		return err
+	}
+	live, err := runtime.DefaultUnstructuredConverter.ToUnstructured(sanitize.Pod(original))
+	if err != nil {
+		return fmt.Errorf("failed to convert the original pod: %v", err)
+	}
+	desired, err := runtime.DefaultUnstructuredConverter.ToUnstructured(created)
+	if err != nil {
+		return fmt.Errorf("failed to convert the dry-run pod: %v", err)
+	}
+	allowed, disallowed := c.whitelist.Partition(policy.Diff(live, desired))
+	switch {
+	case len(allowed) == 0 && len(disallowed) == 0:
+		return &validationError{reason: "the manifest does not change anything, the pod would fail the same way"}
+	case len(disallowed) > 0 && (types.DisallowedChanges == policy.ModeReject || len(allowed) == 0):
+		return &validationError{reason: fmt.Sprintf("the manifest changes fields that must not be changed: %s, only these may change: %s",
+			strings.Join(policy.Paths(disallowed), ", "), types.AllowedChanges)}
+	case len(disallowed) > 0:
+		if err := policy.Apply(live, allowed); err != nil {
+			return fmt.Errorf("failed to prune the remediation: %v", err)
+		}
+		live["apiVersion"], live["kind"] = "v1", "Pod"
+		manifest, err := yaml.Marshal(live)
+		if err != nil {
+			return fmt.Errorf("failed to encode the pruned remediation: %v", err)
+		}
+		proposal.Manifest = string(manifest)
+		// the pruned manifest is a new combination of fields, so it goes through the dry-run again
+		if created, err = dryRun(ctx, proposal.Manifest, original); err != nil {
+			return err
+		}
+		c.Logger.Info("pruned disallowed changes from the remediation", zap.String("pod", original.Namespace+"/"+original.Name),
+			zap.Strings("pruned", policy.Paths(disallowed)))
+	}
+	if err := c.checkQuota(ctx, created, original); err != nil {
+		return err
+	}
+	if err := c.checkScheduling(ctx, created, original); err != nil {
+		return err
+	}
+
+	c.assess(record, proposal, original.Namespace, allowed, disallowed, secrets)
+	return nil
+}
+
+// assess records the changes of the proposal and their risk
+func (c *controller) assess(record *records.Remediation, proposal *types.Proposal, namespace string, applied, pruned []policy.Change, secrets *redact.Session) {
+	proposal.ChangedFields = policy.Paths(applied)
+	record.Status.AppliedChanges = changeStrings(applied, secrets)
+	record.Status.PrunedChanges = changeStrings(pruned, secrets)
+	assessment := c.risk.Assess(namespace, applied)
+	record.Status.RiskScore = assessment.Score
+	record.Status.RiskReasons = assessment.Reasons
+	record.Status.Decision = assessment.Decision
+}
+
+// dryRun validates the manifest through the k8s-agent and returns the dry-run pod with the name of the original
+func dryRun(ctx context.Context, manifest string, original *corev1.Pod) (*corev1.Pod, error) {
+	pod, err := handlers.ValidateRemediation(ctx, manifest)
+	if err != nil {
+		var rejected *handlers.RejectedError
+		if errors.As(err, &rejected) {
+			return nil, &validationError{reason: rejected.Error()}
+		}
+		return nil, err
+	}
+	pod = sanitize.Pod(pod)
+	pod.Name, pod.GenerateName = original.Name, original.GenerateName
+	return pod, nil
+}
+
+// changeStrings formats the changes for the record, the values are redacted as the record is readable by anyone
+// who can list remediations
+func changeStrings(changes []policy.Change, secrets *redact.Session) []string {
+	var out []string
+	for _, change := range changes {
+		out = append(out, secrets.RedactText(change.String()))
+	}
+	return out
+}
+
+// usedAttempts returns the ai calls already made for the current errors of the Result
+func (c *controller) usedAttempts(result string) int {
+	c.repairAttemptsMu.Lock()
+	defer c.repairAttemptsMu.Unlock()
+	return c.repairAttempts[result]
+}
+
+// recordAttempts stores the ai calls made for the Result, they are counted until its errors change. The Results
+// without a name are not tracked.
+func (c *controller) recordAttempts(result string, attempts int) {
+	if result == "" {
+		return
+	}
+	c.repairAttemptsMu.Lock()
+	defer c.repairAttemptsMu.Unlock()
+	c.repairAttempts[result] = attempts
+}
+
+// resetAttempts gives the Result a new budget of ai calls, once its errors changed or it was deleted
+func (c *controller) resetAttempts(result string) {
+	c.repairAttemptsMu.Lock()
+	defer c.repairAttemptsMu.Unlock()
+	delete(c.repairAttempts, result)
+}
@@ -0,0 +1,186 @@
+package k8scontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VedRatan/remediation-server/metrics"
+	"github.com/VedRatan/remediation-server/notify"
+	"github.com/VedRatan/remediation-server/policy"
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// approvalPollInterval is how often a remediation AwaitingApproval is checked for the approval annotation
+const approvalPollInterval = 10 * time.Second
+
+// awaitingApprovalError postpones a remediation until its record is approved. The worker and the locks are released
+// meanwhile, the remediation resumes when its object is reconciled again.
+type awaitingApprovalError struct {
+	record string
+}
+
+func (e *awaitingApprovalError) Error() string {
+	return fmt.Sprintf("remediation %s is awaiting its approval", e.record)
+}
+
+// refusedError means that the remediation must not be applied, because of its risk or its approver
+type refusedError struct {
+	reason string
+}
+
+func (e *refusedError) Error() string {
+	return e.reason
+}
+
+// newRiskScorer sets up the risk scoring from the flags
+func newRiskScorer() (*policy.RiskScorer, error) {
+	return policy.NewRiskScorer(policy.RiskConfig{
+		PathWeights:      types.RiskPathWeights,
+		NamespaceWeights: types.RiskNamespaceWeights,
+		AutoApplyBelow:   types.RiskAutoApplyBelow,
+		RefuseAbove:      types.RiskRefuseAbove,
+	})
+}
+
+// approve acts on the risk decision of the validated remediation: auto-applied remediations pass right away and
+// refused ones return a *refusedError. The others are saved on their record and return an *awaitingApprovalError
+// until the approval annotation is set on the record, see checkApproval.
+func (c *controller) approve(ctx context.Context, run *remediationRun) error {
+	record := run.record
+	status := &record.Status
+	if status.Phase == records.PhaseAwaitingApproval {
+		return c.checkApproval(ctx, record)
+	}
+	metrics.RiskScore.WithLabelValues(status.Decision).Observe(status.RiskScore)
+	metrics.RiskDecisions.WithLabelValues(status.Decision, record.Namespace).Inc()
+	c.Logger.Info("assessed the risk of the remediation", zap.String("target", record.Spec.Target), zap.String("decision", status.Decision),
+		zap.Float64("riskScore", status.RiskScore), zap.Strings("riskReasons", status.RiskReasons))
+
+	switch status.Decision {
+	case policy.DecisionAutoApply:
+		c.notify(ctx, record, "auto-applying the remediation")
+		return nil
+	case policy.DecisionRefuse:
+		c.notify(ctx, record, "refused the remediation, its risk is too high")
+		return &refusedError{reason: fmt.Sprintf("risk score %g is above %g", status.RiskScore, types.RiskRefuseAbove)}
+	}
+
+	if record.Name == "" {
+		return &refusedError{reason: "the remediation requires an approval but its record could not be created"}
+	}
+	// a previous iteration may have been approved already, every remediation is approved on its own
+	delete(record.Annotations, records.ApprovalAnnotation)
+	deadline := metav1.NewTime(time.Now().Add(types.ApprovalTimeout))
+	status.Phase = records.PhaseAwaitingApproval
+	status.Proposal = run.secrets.RedactText(describeProposal(run.proposal))
+	status.ApprovalDeadline = &deadline
+	if err := c.recorder.Update(ctx, record); err != nil {
+		return err
+	}
+	c.notify(ctx, record, fmt.Sprintf("the remediation requires an approval, annotate remediation %s/%s with %s=%s or %s",
+		record.Namespace, record.Name, records.ApprovalAnnotation, records.Approved, records.Rejected))
+	return &awaitingApprovalError{record: record.Namespace + "/" + record.Name}
+}
+
+// checkApproval reads the approval annotation of the record AwaitingApproval, it returns an *awaitingApprovalError
+// until the remediation is approved, and a *refusedError once it is rejected or its ApprovalDeadline passed
+func (c *controller) checkApproval(ctx context.Context, record *records.Remediation) error {
+	status := &record.Status
+	if err := c.recorder.Refresh(ctx, record); err != nil {
+		// the approval is checked again on the next reconcile
+		c.Logger.Error("failed to check the approval", zap.Error(err), zap.String("remediation", record.Namespace+"/"+record.Name))
+	}
+	switch approval := record.Annotations[records.ApprovalAnnotation]; {
+	case approval == records.Rejected:
+		c.notify(ctx, record, "the remediation was rejected")
+		return &refusedError{reason: "rejected by the approver"}
+	case approval == records.Approved:
+	case status.ApprovalDeadline == nil || time.Now().After(status.ApprovalDeadline.Time):
+		c.notify(ctx, record, "refused the remediation, its approval timed out")
+		return &refusedError{reason: fmt.Sprintf("not approved within %s", types.ApprovalTimeout)}
+	default:
+		return &awaitingApprovalError{record: record.Namespace + "/" + record.Name}
+	}
+
+	c.Logger.Info("remediation approved", zap.String("remediation", record.Namespace+"/"+record.Name))
+	status.Phase = records.PhaseInProgress
+	status.Proposal, status.ApprovalDeadline = "", nil
+	return c.recorder.Update(ctx, record)
+}
+
+// describeProposal renders the remediation for its approver: the manifest of the pod, or the patches of its workload
+func describeProposal(proposal *remediation) string {
+	if len(proposal.patches) == 0 {
+		return proposal.Manifest
+	}
+	var out strings.Builder
+	for _, patch := range proposal.patches {
+		fmt.Fprintf(&out, "%s: %s\n", patch.Action, patch.Data)
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// suspend keeps the run awaiting its approval until its object is reconciled again, runs are keyed by the
+// namespace/name of their pod. The runs are only kept in memory, the records of the runs still pending when the
+// controller stops are cancelled.
+func (c *controller) suspend(run *remediationRun) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	c.pending[run.record.Spec.Target] = run
+}
+
+// resume takes the run of the pod awaiting its approval, nil if there is none
+func (c *controller) resume(target string) *remediationRun {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	run := c.pending[target]
+	delete(c.pending, target)
+	return run
+}
+
+// awaitingApproval tells whether the remediation of the pod awaits its approval
+func (c *controller) awaitingApproval(target string) bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	return c.pending[target] != nil
+}
+
+// cancelPending cancels the runs awaiting their approval that match, ex: the runs of a deleted Result
+func (c *controller) cancelPending(ctx context.Context, reason string, match func(record *records.Remediation) bool) {
+	c.pendingMu.Lock()
+	var cancelled []*remediationRun
+	for target, run := range c.pending {
+		if match(run.record) {
+			cancelled = append(cancelled, run)
+			delete(c.pending, target)
+		}
+	}
+	c.pendingMu.Unlock()
+	for _, run := range cancelled {
+		c.Logger.Info("cancelled the remediation awaiting its approval", zap.String("remediation", run.record.Namespace+"/"+run.record.Name),
+			zap.String("reason", reason))
+		c.finishRecord(ctx, run.record, records.PhaseCancelled, reason)
+	}
+}
+
+func (c *controller) notify(ctx context.Context, record *records.Remediation, text string) {
+	remediation := ""
+	if record.Name != "" {
+		remediation = record.Namespace + "/" + record.Name
+	}
+	c.notifier.Notify(ctx, notify.Notification{
+		Text:        fmt.Sprintf("%s %s: %s (risk score %g)", record.Spec.Kind, record.Spec.Target, text, record.Status.RiskScore),
+		Remediation: remediation,
+		Target:      record.Spec.Target,
+		Kind:        record.Spec.Kind,
+		Decision:    record.Status.Decision,
+		RiskScore:   record.Status.RiskScore,
+		RiskReasons: record.Status.RiskReasons,
+		Message:     record.Status.Explanation,
+	})
+}
@@ -0,0 +1,54 @@
+package k8scontroller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VedRatan/remediation-server/handlers"
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// validateInSandbox launches the remediated manifest as a shadow pod in the sandbox namespace and waits for it to
+// become Ready and stay stable, before the faulty pod gets replaced. The shadow pod is removed whatever the
+// outcome, if it does not become Ready the report of its failure is returned along with the error. The shadow pod
+// of a pod with a persistent volume would share or provision its storage, such a remediation is rejected unless
+// types.SandboxSkipVolumes lets it through untried, which is reported on the record.
+func (c *controller) validateInSandbox(ctx context.Context, record *records.Remediation, manifest string, original *corev1.Pod) (string, error) {
+	for _, volume := range original.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil && volume.Ephemeral == nil {
+			continue
+		}
+		if !types.SandboxSkipVolumes {
+			return "", fmt.Errorf("the pod mounts the persistent volume %s, it cannot be tried in the sandbox", volume.Name)
+		}
+		c.Logger.Info("the pod mounts a persistent volume, skipping the sandbox", zap.String("pod", original.Namespace+"/"+original.Name),
+			zap.String("volume", volume.Name))
+		record.Status.Sandbox = fmt.Sprintf("skipped, the pod mounts the persistent volume %s", volume.Name)
+		return "", nil
+	}
+
+	shadow, err := handlers.CreateShadow(ctx, manifest, types.SandboxNamespace, types.SandboxNetworkPolicy)
+	if err != nil {
+		return "", fmt.Errorf("failed to launch the shadow pod: %v", err)
+	}
+	c.Logger.Info("launched the shadow pod", zap.String("pod", original.Namespace+"/"+original.Name), zap.String("shadow", shadow.Namespace+"/"+shadow.Name))
+	defer func() {
+		// the cleanup must happen even if the remediation got cancelled
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if err := handlers.DeleteShadow(cleanupCtx, shadow); err != nil {
+			c.Logger.Error("failed to clean up the shadow pod", zap.Error(err), zap.String("shadow", shadow.Namespace+"/"+shadow.Name))
+		}
+	}()
+
+	if err := handlers.WaitForReady(ctx, "Pod", shadow.Namespace, shadow.Name); err != nil {
+		return c.describeFailure(ctx, shadow.Namespace, shadow.Name, original), fmt.Errorf("shadow pod %s: %w", shadow.Name, err)
+	}
+	c.Logger.Info("the shadow pod is Ready", zap.String("shadow", shadow.Namespace+"/"+shadow.Name))
+	record.Status.Sandbox = fmt.Sprintf("the shadow pod %s became Ready", shadow.Name)
+	return "", nil
+}
@@ -0,0 +1,39 @@
+package k8scontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/VedRatan/remediation-server/scheduling"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checkScheduling simulates the scheduling of the remediated pod when the faulty pod could not be scheduled, a
+// remediation that would leave it Pending is rejected with the constraints that failed so that the model can
+// try another one
+func (c *controller) checkScheduling(ctx context.Context, pod, original *corev1.Pod) error {
+	if original.Spec.NodeName != "" {
+		return nil
+	}
+
+	var nodes corev1.NodeList
+	if err := c.clientset.List(ctx, &nodes); err != nil {
+		return fmt.Errorf("failed to list the nodes: %v", err)
+	}
+	var pods corev1.PodList
+	if err := c.clientset.List(ctx, &pods); err != nil {
+		return fmt.Errorf("failed to list the pods: %v", err)
+	}
+	var namespaces corev1.NamespaceList
+	if err := c.clientset.List(ctx, &namespaces); err != nil {
+		return fmt.Errorf("failed to list the namespaces: %v", err)
+	}
+
+	err := scheduling.Check(pod, scheduling.Snapshot{Nodes: nodes.Items, Pods: pods.Items, Namespaces: namespaces.Items})
+	var infeasible *scheduling.InfeasibleError
+	if errors.As(err, &infeasible) {
+		return &validationError{reason: fmt.Sprintf("the remediated pod would stay Pending, %v", infeasible)}
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package k8scontroller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/plan"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// revisionAnnotation holds the revision of the Deployment a ReplicaSet belongs to
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// workloadOf returns the Deployment, StatefulSet or DaemonSet owning the pod, nil for the pods without one
+func (c *controller) workloadOf(ctx context.Context, pod *corev1.Pod) (*plan.Workload, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+	key := apitypes.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}
+	switch ref.Kind {
+	case "ReplicaSet":
+		var rs appsv1.ReplicaSet
+		if err := c.clientset.Get(ctx, key, &rs); err != nil {
+			return nil, fmt.Errorf("failed to get the ReplicaSet %s: %v", ref.Name, err)
+		}
+		deployRef := metav1.GetControllerOf(&rs)
+		if deployRef == nil || deployRef.Kind != "Deployment" {
+			return nil, nil
+		}
+		var deploy appsv1.Deployment
+		if err := c.clientset.Get(ctx, apitypes.NamespacedName{Namespace: pod.Namespace, Name: deployRef.Name}, &deploy); err != nil {
+			return nil, fmt.Errorf("failed to get the Deployment %s: %v", deployRef.Name, err)
+		}
+		return c.deploymentWorkload(ctx, &deploy)
+	case "StatefulSet":
+		var sts appsv1.StatefulSet
+		if err := c.clientset.Get(ctx, key, &sts); err != nil {
+			return nil, fmt.Errorf("failed to get the StatefulSet %s: %v", ref.Name, err)
+		}
+		return &plan.Workload{Kind: "StatefulSet", Namespace: sts.Namespace, Name: sts.Name, Replicas: replicas(sts.Spec.Replicas), Template: sts.Spec.Template}, nil
+	case "DaemonSet":
+		var ds appsv1.DaemonSet
+		if err := c.clientset.Get(ctx, key, &ds); err != nil {
+			return nil, fmt.Errorf("failed to get the DaemonSet %s: %v", ref.Name, err)
+		}
+		return &plan.Workload{Kind: "DaemonSet", Namespace: ds.Namespace, Name: ds.Name, Template: ds.Spec.Template}, nil
+	}
+	return nil, nil
+}
+
+// deploymentWorkload collects the revisions of the Deployment from its ReplicaSets
+func (c *controller) deploymentWorkload(ctx context.Context, deploy *appsv1.Deployment) (*plan.Workload, error) {
+	workload := &plan.Workload{
+		Kind:      "Deployment",
+		Namespace: deploy.Namespace,
+		Name:      deploy.Name,
+		Replicas:  replicas(deploy.Spec.Replicas),
+		Template:  deploy.Spec.Template,
+		Revisions: map[int64]corev1.PodTemplateSpec{},
+	}
+	workload.Revision, _ = strconv.ParseInt(deploy.Annotations[revisionAnnotation], 10, 64)
+
+	var list appsv1.ReplicaSetList
+	if err := c.clientset.List(ctx, &list, client.InNamespace(deploy.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list the ReplicaSets of the Deployment %s: %v", deploy.Name, err)
+	}
+	for _, rs := range list.Items {
+		if ref := metav1.GetControllerOf(&rs); ref == nil || ref.UID != deploy.UID {
+			continue
+		}
+		if revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64); err == nil {
+			workload.Revisions[revision] = rs.Spec.Template
+		}
+	}
+	return workload, nil
+}
+
+func replicas(r *int32) *int32 {
+	if r == nil {
+		one := int32(1)
+		return &one
+	}
+	return r
+}
+
+// describeRevisions lists the revisions of a Deployment with the images of their containers, for the prompt
+func describeRevisions(workload *plan.Workload) []string {
+	if workload == nil {
+		return nil
+	}
+	revisions := make([]int64, 0, len(workload.Revisions))
+	for revision := range workload.Revisions {
+		revisions = append(revisions, revision)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i] < revisions[j] })
+
+	var out []string
+	for _, revision := range revisions {
+		var images []string
+		for _, container := range workload.Revisions[revision].Spec.Containers {
+			images = append(images, container.Name+"="+container.Image)
+		}
+		current := ""
+		if revision == workload.Revision {
+			current = " (current)"
+		}
+		out = append(out, fmt.Sprintf("revision %d%s: %s", revision, current, strings.Join(images, ", ")))
+	}
+	return out
+}
+
+// faultyPodOf returns the name of a pod of the Deployment, StatefulSet or DaemonSet to remediate, the first pod
+// which is not Ready or else the first pod, for the requests naming a workload rather than a pod
+func (c *controller) faultyPodOf(ctx context.Context, kind, namespace, name string) (string, error) {
+	key := apitypes.NamespacedName{Namespace: namespace, Name: name}
+	var selector *metav1.LabelSelector
+	switch kind {
+	case "Deployment":
+		var deploy appsv1.Deployment
+		if err := c.clientset.Get(ctx, key, &deploy); err != nil {
+			return "", fmt.Errorf("failed to get the Deployment %s: %v", name, err)
+		}
+		selector = deploy.Spec.Selector
+	case "StatefulSet":
+		var sts appsv1.StatefulSet
+		if err := c.clientset.Get(ctx, key, &sts); err != nil {
+			return "", fmt.Errorf("failed to get the StatefulSet %s: %v", name, err)
+		}
+		selector = sts.Spec.Selector
+	case "DaemonSet":
+		var ds appsv1.DaemonSet
+		if err := c.clientset.Get(ctx, key, &ds); err != nil {
+			return "", fmt.Errorf("failed to get the DaemonSet %s: %v", name, err)
+		}
+		selector = ds.Spec.Selector
+	default:
+		return "", fmt.Errorf("only pods, Deployments, StatefulSets and DaemonSets can be remediated, got the kind %q", kind)
+	}
+
+	podSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector of the %s %s: %v", kind, name, err)
+	}
+	var pods corev1.PodList
+	if err := c.clientset.List(ctx, &pods, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: podSelector}); err != nil {
+		return "", fmt.Errorf("failed to list the pods of the %s %s: %v", kind, name, err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("the %s %s has no pods", kind, name)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+	for _, pod := range pods.Items {
+		if !isReady(&pod) {
+			return pod.Name, nil
+		}
+	}
+	return pods.Items[0].Name, nil
+}
+
+func isReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
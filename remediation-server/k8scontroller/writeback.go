@@ -0,0 +1,71 @@
+package k8scontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/VedRatan/remediation-server/records"
+	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The annotations reporting the latest remediation on its Result, remediationAnnotation links the Remediation
+// record in namespace/name form
+const (
+	remediationAnnotation         = "k8swatchdog.io/remediation"
+	remediationPhaseAnnotation    = "k8swatchdog.io/remediation-phase"
+	remediationTimeAnnotation     = "k8swatchdog.io/remediation-time"
+	remediationBackendAnnotation  = "k8swatchdog.io/remediation-backend"
+	remediationAttemptsAnnotation = "k8swatchdog.io/remediation-attempts"
+)
+
+// autoRemediationPhase maps the phase of a record to the auto remediation phase of the k8sgpt Result
+func autoRemediationPhase(phase records.Phase) k8sgptv1alpha1.AutoRemediationPhase {
+	switch phase {
+	case records.PhaseInProgress, records.PhaseAwaitingApproval:
+		return k8sgptv1alpha1.AutoRemediationPhaseInProgress
+	case records.PhaseSucceeded:
+		return k8sgptv1alpha1.AutoRemediationPhaseSuccessful
+	case records.PhaseCancelled:
+		return k8sgptv1alpha1.AutoRemediationPhaseCompleted
+	case records.PhaseFailed, records.PhaseEscalated, records.PhaseRefused:
+		return k8sgptv1alpha1.AutoRemediationAborted
+	}
+	return k8sgptv1alpha1.AutoRemediationPhaseNotStarted
+}
+
+// writeBack reports the remediation on its Result, so that it can be seen from the k8sgpt tooling: the
+// autoRemediationStatus of the spec follows the phase of the record and the annotations carry the details. The
+// write-back changes the spec and so the generation of the Result, the Results are deduplicated on their errors.
+func (c *controller) writeBack(ctx context.Context, result *k8sgptv1alpha1.Result, record *records.Remediation) error {
+	annotations := map[string]string{
+		remediationPhaseAnnotation:    string(record.Status.Phase),
+		remediationTimeAnnotation:     time.Now().UTC().Format(time.RFC3339),
+		remediationAttemptsAnnotation: strconv.Itoa(record.Status.Attempts),
+	}
+	if record.Name != "" {
+		annotations[remediationAnnotation] = record.Namespace + "/" + record.Name
+	}
+	if record.Status.Backend != "" {
+		annotations[remediationBackendAnnotation] = record.Status.Backend
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+		"spec": map[string]any{
+			"autoRemediationStatus": map[string]any{"phase": autoRemediationPhase(record.Status.Phase)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode the status of the Result: %v", err)
+	}
+	patched := &k8sgptv1alpha1.Result{ObjectMeta: metav1.ObjectMeta{Namespace: result.Namespace, Name: result.Name}}
+	if err := c.clientset.Patch(ctx, patched, client.RawPatch(apitypes.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("failed to write the status back to the Result %s/%s: %v", result.Namespace, result.Name, err)
+	}
+	return nil
+}
@@ -7,18 +7,30 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/VedRatan/remediation-server/ai"
+	"github.com/VedRatan/remediation-server/analyzer"
 	"github.com/VedRatan/remediation-server/k8s"
 	"github.com/VedRatan/remediation-server/k8scontroller"
+	"github.com/VedRatan/remediation-server/metrics"
+	"github.com/VedRatan/remediation-server/plan"
+	"github.com/VedRatan/remediation-server/policy"
+	"github.com/VedRatan/remediation-server/server"
 	"github.com/VedRatan/remediation-server/types"
 	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
 	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -29,32 +41,66 @@ var (
 	k8sClient client.Client
 )
 
-// func startServer(router *mux.Router) {
-// 	port := os.Getenv("SERVER_PORT")
-// 	if port == "" {
-// 		port = "7070" // default port
-// 	}
-// 	server := &http.Server{
-// 		Addr:           fmt.Sprintf(":%s", port),
-// 		Handler:        router,
-// 		ReadTimeout:    10 * time.Second,
-// 		WriteTimeout:   10 * time.Second,
-// 		MaxHeaderBytes: 1 << 20, // Set max header size (e.g., 1 MB)
-// 	}
-
-// 	log.Printf("Remediation server is starting at :%s", port)
-// 	// Start the server
-// 	if err := server.ListenAndServe(); err != nil {
-// 		log.Fatalf("Server failed: %v", err)
-// 	}
-// }
-
 func main() {
 	var runAs string
 	flag.StringVar(&runAs, "runAs", "k8s-controller", "run as a `server` or `k8s-controller`")
 	flag.StringVar(&types.K8sAgentServiceURL, "k8s-agent-url", "", "The LoadBalancer IP or DNS of the k8s-agent-service (required)")
-	flag.StringVar(&types.AiAgent, "ai", "gemini", "AI agent to use as a backend to provide remediations")
+	flag.StringVar(&types.AiAgent, "ai", "gemini", "AI agent to use as a backend to provide remediations, a comma separated list (ex: gemini,openai,ollama) is tried in order")
 	flag.StringVar(&types.AiAgentKey, "api-key", "", "AI agent api key")
+	flag.StringVar(&types.OpenAIKey, "openai-api-key", "", "OpenAI api key, required if openai is one of the ai backends")
+	flag.StringVar(&types.OpenAIModel, "openai-model", "gpt-4o-mini", "OpenAI model to use")
+	flag.StringVar(&types.OllamaURL, "ollama-url", "http://localhost:11434", "Base url of the Ollama server")
+	flag.StringVar(&types.OllamaModel, "ollama-model", "llama3.1", "Ollama model to use")
+	flag.IntVar(&types.AiFailureThreshold, "ai-failure-threshold", 3, "Consecutive failures after which an ai backend is skipped for the cooldown window")
+	flag.DurationVar(&types.AiCooldown, "ai-cooldown", 5*time.Minute, "How long a failing ai backend is skipped before it is tried again")
+	flag.IntVar(&types.MaxConcurrentAiCalls, "max-concurrent-ai-calls", 2, "How many ai calls run at once across the workers, the others wait for their turn. 0 means unlimited")
+	flag.IntVar(&types.MaxRepairAttempts, "max-repair-attempts", 3, "How many times the ai backend is asked for a valid remediation of a single proposal, rejected proposals are fed back to the model")
+	flag.IntVar(&types.MaxAttemptsPerResult, "max-attempts-per-result", 9, "How many times the ai backend is asked for a remediation of a single Result, across its fix iterations and retries. "+
+		"0 means unlimited")
+	flag.IntVar(&types.MaxTokensPerResult, "max-tokens-per-result", 100000, "Token budget of the repair loop of a single Result, 0 means unlimited")
+	flag.IntVar(&types.MaxFixIterations, "max-fix-iterations", 3, "How many fixes are applied and verified before the original pod is rolled back and the remediation escalated")
+	flag.Var(types.VerifyTimeouts, "verify-timeout", "How long a remediated object is given to become Ready or to complete its rollout, per kind, ex: Pod=5m,Deployment=10m,*=10m")
+	flag.Var(types.VerifyStability, "verify-stability", "How long a remediated object has to stay Ready before it is considered healthy, per kind, ex: Pod=15s,*=0s")
+	flag.IntVar(&types.PromptLogBudget, "prompt-log-budget", 4000, "Size in bytes of the logs of a single container in the prompt, the most recent lines and stack traces are kept")
+	flag.IntVar(&types.PromptEventsBudget, "prompt-events-budget", 2000, "Size in bytes of the events in the prompt, the most recent events are kept")
+	flag.BoolVar(&types.Redact, "redact", true, "Mask inline env values, secret-looking strings and the configured annotations before the prompt is sent to the ai backend")
+	flag.StringVar(&types.RedactAnnotations, "redact-annotations", "kubectl.kubernetes.io/last-applied-configuration", "Comma separated annotation keys whose values are masked")
+	flag.Float64Var(&types.RedactEntropy, "redact-entropy", 4.5, "Shannon entropy in bits per character above which a token is masked as a secret, 0 disables the check")
+	flag.Var(&types.RedactPatterns, "redact-pattern", "Custom regex to mask, can be repeated. If the regex has a capture group only the group is masked")
+	flag.StringVar(&types.PromptConfigMap, "prompt-configmap", "", "namespace/name of the ConfigMap holding the prompt templates, the built-in prompt is used if empty")
+	flag.StringVar(&types.AllowedChanges, "allowed-changes", strings.Join(policy.DefaultAllowedChanges, ","), "Comma separated paths a remediation is allowed to change, a path covers every field below it, [*] matches any list item")
+	flag.StringVar(&types.DisallowedChanges, "disallowed-changes", policy.ModePrune, "What to do with a remediation that changes other paths: reject, feeding the reason back to the ai backend, or prune the disallowed changes")
+	for path, weight := range policy.DefaultPathWeights {
+		types.RiskPathWeights[path] = weight
+	}
+	flag.StringVar(&types.SandboxNamespace, "sandbox-namespace", "", "Namespace the remediated pods are launched in as shadow pods first, the faulty pod is only replaced if its shadow becomes Ready and stays stable. Empty disables the sandbox")
+	flag.BoolVar(&types.SandboxNetworkPolicy, "sandbox-network-policy", false, "Isolate the shadow pods with a deny-all NetworkPolicy")
+	flag.BoolVar(&types.SandboxSkipVolumes, "sandbox-skip-volumes", false, "Apply the remediations of the pods with a persistent volume without trying them in the sandbox, they are rejected otherwise")
+	flag.StringVar(&types.AllowedActions, "allowed-actions", strings.Join(plan.AllActions, ","), "Comma separated action types the remediation plans may use: "+strings.Join(plan.AllActions, ", "))
+	flag.Var(types.RiskPathWeights, "risk-path-weights", "Risk weight of the changes per path, merged into the defaults, ex: spec.containers[*].image=3,*=5. "+
+		"The most specific path matching a change is used")
+	flag.Var(types.RiskNamespaceWeights, "risk-namespace-weights", "Multiplier of the risk score per namespace, ex: kube-system=3,*=1")
+	flag.Float64Var(&types.RiskAutoApplyBelow, "risk-auto-apply-below", 5, "Risk score below which a remediation is applied without approval")
+	flag.Float64Var(&types.RiskRefuseAbove, "risk-refuse-above", 12, "Risk score above which a remediation is refused, remediations in between wait for an approval")
+	flag.DurationVar(&types.ApprovalTimeout, "approval-timeout", time.Hour, "How long a remediation waits for the k8swatchdog.io/approval annotation on its record before it is refused")
+	flag.DurationVar(&types.RemediationCooldown, "remediation-cooldown", 10*time.Minute, "How long an object is not remediated again after a remediation, whatever triggered it. 0 disables the cool-down")
+	flag.IntVar(&types.Workers, "workers", 4, "Number of workers remediating concurrently, an object is never remediated by two workers at once")
+	flag.StringVar(&types.NotifyWebhook, "notify-webhook", "", "Url the risk decisions and escalations are posted to as JSON, ex: a Slack incoming webhook. Notifications are only logged if empty")
+	flag.StringVar(&types.MetricsAddr, "metrics-addr", ":9090", "Address the prometheus metrics are served on, empty disables them")
+	flag.BoolVar(&types.LeaderElect, "leader-elect", true, "Elect a leader through a Lease in the k8s-controller mode, only the leader remediates. Disable it for local development")
+	flag.StringVar(&types.LeaderElectionID, "leader-election-id", "remediation-server", "Name of the Lease of the leader election")
+	flag.StringVar(&types.LeaderElectionNS, "leader-election-namespace", "", "Namespace of the Lease of the leader election, the namespace of the pod (POD_NAMESPACE) or default if empty")
+	flag.DurationVar(&types.LeaseDuration, "lease-duration", 15*time.Second, "How long the Lease of a leader that stopped renewing it is kept before another replica takes over, "+
+		"a leader shutting down releases it right away")
+	flag.StringVar(&types.ServerAddr, "server-addr", ":7070", "Address the api of the server mode is served on")
+	flag.StringVar(&types.ServerToken, "server-token", "", "Bearer token required by the api of the server mode, SERVER_TOKEN is used if empty")
+	flag.BoolVar(&types.WatchResults, "watch-results", true, "Remediate the objects of the k8sgpt Results, disable it when the k8sgpt operator is not installed")
+	flag.BoolVar(&types.DetectEvents, "detect-events", false, "Detect the faulty pods from their Warning events (BackOff, Failed, FailedScheduling, Unhealthy, FailedMount) "+
+		"and status transitions, without k8sgpt")
+	flag.DurationVar(&types.DetectDebounce, "detect-debounce", 30*time.Second, "How long the detector waits for more events of a pod before it is remediated")
+	flag.StringVar(&types.DetectIgnoreNamespaces, "detect-ignore-namespaces", "kube-system", "Comma separated namespaces the detector and the analyzers ignore, the sandbox namespace is always ignored")
+	flag.DurationVar(&types.AnalyzeInterval, "analyze-interval", 0, "How often the built-in analyzers look for faulty objects, without k8sgpt. 0 disables them")
+	flag.StringVar(&types.Analyzers, "analyzers", strings.Join(analyzer.Names(), ","), "Comma separated built-in analyzers to run: "+strings.Join(analyzer.Names(), ", "))
 	flag.BoolVar(&types.Insecure, "insecure", true, "Use insecure (non-TLS) connection to k8s-agent-service.")
 	flag.Parse()
 	types.AiAgent = strings.ToLower(types.AiAgent) // make sure that the case is uniform
@@ -68,7 +114,22 @@ func main() {
 		fmt.Println("error: ", err)
 		os.Exit(1)
 	}
-	if types.AiAgentKey == "" {
+	if types.Workers < 1 {
+		fmt.Println("Error: --workers must be at least 1")
+		os.Exit(1)
+	}
+	if types.DisallowedChanges != policy.ModeReject && types.DisallowedChanges != policy.ModePrune {
+		fmt.Printf("Error: --disallowed-changes must be %s or %s\n", policy.ModeReject, policy.ModePrune)
+		os.Exit(1)
+	}
+	for _, action := range strings.Split(types.AllowedActions, ",") {
+		if action = strings.TrimSpace(action); action != "" && !slices.Contains(plan.AllActions, action) {
+			fmt.Printf("Error: unknown action %q in --allowed-actions, expected one of %s\n", action, strings.Join(plan.AllActions, ", "))
+			os.Exit(1)
+		}
+	}
+	backends := ai.ParseBackends(types.AiAgent)
+	if slices.Contains(backends, "gemini") && types.AiAgentKey == "" {
 		apiKey := os.Getenv("GEMINI_API_KEY")
 		if apiKey == "" {
 			fmt.Println("GEMINI_API_KEY or --api-key must be set")
@@ -76,44 +137,127 @@ func main() {
 		}
 		types.AiAgentKey = apiKey
 	}
+	if slices.Contains(backends, "openai") && types.OpenAIKey == "" {
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			fmt.Println("OPENAI_API_KEY or --openai-api-key must be set")
+			os.Exit(1)
+		}
+		types.OpenAIKey = apiKey
+	}
 
-	switch runAs {
-	case "server":
-		// r := mux.NewRouter()
-		// Define the HTTP server
-		// r.HandleFunc("/webhook", handlers.WebhookHandler)
+	if runAs != "server" && runAs != "k8s-controller" {
+		fmt.Printf("Error: --runAs must be server or k8s-controller, got %q\n", runAs)
+		os.Exit(1)
+	}
+	if runAs == "server" && types.ServerToken == "" {
+		types.ServerToken = os.Getenv("SERVER_TOKEN")
+		if types.ServerToken == "" {
+			fmt.Println("SERVER_TOKEN or --server-token must be set in server mode")
+			os.Exit(1)
+		}
+	}
 
-		// startServer(r)
-		fmt.Println("server mode is still pending, as k8sgpt doesn't integrate directly to any third party service except slack and ")
-	case "k8s-controller":
-		utilruntime.Must(k8sgptv1alpha1.AddToScheme(scheme))
-		utilruntime.Must(corev1.AddToScheme(scheme))
-		k8sClient = k8s.NewOrDie(scheme)
-		// Create a new controller
-		c := k8scontroller.NewController(k8sClient)
+	if runAs == "k8s-controller" && !types.WatchResults && !types.DetectEvents && types.AnalyzeInterval <= 0 {
+		fmt.Println("Error: --watch-results, --detect-events or --analyze-interval must be enabled in the k8s-controller mode")
+		os.Exit(1)
+	}
 
-		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-		defer cancel()
-		var wg wait.Group
+	utilruntime.Must(k8sgptv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+	utilruntime.Must(batchv1.AddToScheme(scheme))
+	utilruntime.Must(networkingv1.AddToScheme(scheme))
+	utilruntime.Must(storagev1.AddToScheme(scheme))
+	k8sClient = k8s.NewOrDie(scheme)
+	// Create a new controller, the server mode runs the same remediation pipeline
+	c := k8scontroller.NewController(k8sClient)
 
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	var wg wait.Group
+	if types.MetricsAddr != "" {
 		wg.StartWithContext(ctx, func(ctx context.Context) {
-			c.Logger.Info("starting informer...", zap.String("gvr", "core.k8sgpt.ai/v1alpha1/results"))
-			c.Informer.Run(ctx.Done())
+			metrics.Serve(ctx, types.MetricsAddr, c.Logger)
 		})
-		if !cache.WaitForCacheSync(ctx.Done(), c.Informer.HasSynced) {
-			cancel()
-			c.Logger.Error("failed to wait for cache sync", zap.String("gvr", "core.k8sgpt.ai/v1alpha1/results"))
+	}
+
+	if types.PromptConfigMap != "" {
+		promptNs, promptName, err := cache.SplitMetaNamespaceKey(types.PromptConfigMap)
+		if err != nil || promptNs == "" {
+			c.Logger.Error("--prompt-configmap must be in namespace/name form", zap.String("value", types.PromptConfigMap))
 			os.Exit(1)
 		}
+		if err := c.Prompts.Watch(ctx, k8s.NewDynamicClient(), promptNs, promptName); err != nil {
+			c.Logger.Error("failed to watch the prompt templates", zap.Error(err))
+			os.Exit(1)
+		}
+	}
 
-		// Start the controller
-		c.Start(ctx)
+	switch runAs {
+	case "server":
+		// Serve returns once the remediations it started are done
+		err := server.New(c.Remediate, types.ServerToken, c.Logger).Serve(ctx, types.ServerAddr)
+		c.FlushEvents()
+		cancel()
+		wg.Wait()
+		if err != nil {
+			c.Logger.Error("remediation api failed", zap.Error(err))
+			os.Exit(1) //nolint:gocritic
+		}
+	case "k8s-controller":
+		synced := make([]cache.InformerSynced, 0, len(c.Informers))
+		for _, informer := range c.Informers {
+			wg.StartWithContext(ctx, func(ctx context.Context) {
+				informer.Run(ctx.Done())
+			})
+			synced = append(synced, informer.HasSynced)
+		}
+		c.Logger.Info("starting informers...", zap.Bool("results", types.WatchResults), zap.Bool("detector", types.DetectEvents))
+		if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+			cancel()
+			c.Logger.Error("failed to wait for cache sync")
+			os.Exit(1)
+		}
 
-		select { //nolint:gosimple
-		case <-ctx.Done():
+		// the informers run on every replica so that a new leader starts with warm caches
+		run := func(ctx context.Context) {
+			// Start the controller
+			c.Start(ctx)
+			<-ctx.Done()
 			c.Stop()
+		}
+		if !types.LeaderElect {
+			run(ctx)
 			return
 		}
+		if err := k8s.RunAsLeader(ctx, leaderElection(), run, c.Logger); err != nil {
+			// the remediations still stopping are abandoned, the new leader remediates their Results again
+			c.Logger.Error("leader election failed", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+}
+
+// leaderElection configures the election of the replica running the controller from the flags
+func leaderElection() k8s.LeaderElection {
+	namespace := types.LeaderElectionNS
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "remediation-server"
+	}
+	return k8s.LeaderElection{
+		Namespace: namespace,
+		Name:      types.LeaderElectionID,
+		// the pod name is unique, the uuid tells the restarts of a pod apart
+		Identity:      hostname + "_" + string(uuid.NewUUID()),
+		LeaseDuration: types.LeaseDuration,
 	}
 }
 
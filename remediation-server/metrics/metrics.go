@@ -0,0 +1,45 @@
+// Package metrics exposes the prometheus metrics of the remediation-server.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+var (
+	// RiskScore is the risk score of the remediations, by the decision taken on them
+	RiskScore = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "k8swatchdog_remediation_risk_score",
+		Help:    "Risk score of the remediations proposed by the ai backend.",
+		Buckets: []float64{1, 2, 3, 5, 8, 13, 21},
+	}, []string{"decision"})
+	// RiskDecisions counts the remediations per decision and namespace
+	RiskDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8swatchdog_remediation_risk_decisions_total",
+		Help: "Remediations that were auto-applied, sent for approval or refused because of their risk score.",
+	}, []string{"decision", "namespace"})
+)
+
+// Serve exposes the metrics on /metrics until the context is done
+func Serve(ctx context.Context, addr string, logger *zap.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx) //nolint:contextcheck
+	}()
+	logger.Info("serving metrics", zap.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("metrics server failed", zap.Error(err))
+	}
+}
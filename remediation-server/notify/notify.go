@@ -0,0 +1,72 @@
+// Package notify sends the remediation events that need a human to a webhook, ex: a Slack incoming webhook.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Notification is the JSON payload posted to the webhook, Text is a human readable summary so that chat
+// webhooks can display it as is
+type Notification struct {
+	Text        string   `json:"text"`
+	Remediation string   `json:"remediation,omitempty"`
+	Target      string   `json:"target"`
+	Kind        string   `json:"kind"`
+	Decision    string   `json:"decision,omitempty"`
+	RiskScore   float64  `json:"riskScore"`
+	RiskReasons []string `json:"riskReasons,omitempty"`
+	Message     string   `json:"message,omitempty"`
+}
+
+// Notifier posts notifications to a webhook, a Notifier without url only logs them
+type Notifier struct {
+	url    string
+	client *http.Client
+	logger *zap.Logger
+}
+
+func NewNotifier(url string, logger *zap.Logger) *Notifier {
+	return &Notifier{url: url, client: &http.Client{Timeout: 10 * time.Second}, logger: logger}
+}
+
+// Notify sends the notification, failures are only logged as notifications must not block remediations
+func (n *Notifier) Notify(ctx context.Context, notification Notification) {
+	n.logger.Info("notification", zap.String("text", notification.Text), zap.String("target", notification.Target),
+		zap.String("decision", notification.Decision), zap.Float64("riskScore", notification.RiskScore), zap.Strings("riskReasons", notification.RiskReasons))
+	if n.url == "" {
+		return
+	}
+	if err := n.post(ctx, notification); err != nil {
+		n.logger.Error("failed to send notification", zap.Error(err), zap.String("target", notification.Target))
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notification webhook returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
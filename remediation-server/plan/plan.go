@@ -0,0 +1,362 @@
+// Package plan validates and executes the typed remediation plans returned by the ai backends. The pod actions
+// are applied to a copy of the faulty pod, which then goes through the same checks as any remediated manifest,
+// the workload actions are turned into targeted patches of the workload owning the pod.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VedRatan/remediation-server/policy"
+	"github.com/VedRatan/remediation-server/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Action types
+const (
+	SetImage           = "setImage"
+	SetEnv             = "setEnv"
+	SetResources       = "setResources"
+	SetProbe           = "setProbe"
+	RollbackToRevision = "rollbackToRevision"
+	Scale              = "scale"
+	Restart            = "restart"
+)
+
+// AllActions are all the action types, the pod actions first
+var AllActions = []string{SetImage, SetEnv, SetResources, SetProbe, RollbackToRevision, Scale, Restart}
+
+// RestartedAtAnnotation is set on the pod template by restart, like kubectl rollout restart does
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Patch content types
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+)
+
+// IsWorkloadAction reports whether the action applies to the workload owning the pod rather than to the pod
+func IsWorkloadAction(actionType string) bool {
+	return actionType == RollbackToRevision || actionType == Scale || actionType == Restart
+}
+
+// Split separates the pod actions from the workload actions, a plan must not mix them as the pod is replaced by
+// the workload anyway
+func Split(actions []types.Action, allowed []string) (pod, workload []types.Action, err error) {
+	if len(actions) == 0 {
+		return nil, nil, fmt.Errorf("the plan has no actions")
+	}
+	for i, action := range actions {
+		if !slices.Contains(AllActions, action.Type) {
+			return nil, nil, fmt.Errorf("action %d has the unknown type %q, expected one of %s", i+1, action.Type, strings.Join(AllActions, ", "))
+		}
+		if !slices.Contains(allowed, action.Type) {
+			return nil, nil, fmt.Errorf("action %d: %s is not allowed, only %s are", i+1, action.Type, strings.Join(allowed, ", "))
+		}
+		if IsWorkloadAction(action.Type) {
+			workload = append(workload, action)
+		} else {
+			pod = append(pod, action)
+		}
+	}
+	if len(pod) > 0 && len(workload) > 0 {
+		return nil, nil, fmt.Errorf("the plan must not mix pod actions (%s, %s, %s, %s) with workload actions (%s, %s, %s)",
+			SetImage, SetEnv, SetResources, SetProbe, RollbackToRevision, Scale, Restart)
+	}
+	return pod, workload, nil
+}
+
+// ApplyToPod returns a copy of the pod with the pod actions applied
+func ApplyToPod(pod *corev1.Pod, actions []types.Action) (*corev1.Pod, error) {
+	pod = pod.DeepCopy()
+	for i, action := range actions {
+		container := findContainer(pod, action.Container)
+		if container == nil {
+			return nil, fmt.Errorf("action %d: %s needs the name of one of the containers of the pod, got %q", i+1, action.Type, action.Container)
+		}
+		var err error
+		switch action.Type {
+		case SetImage:
+			err = setImage(container, action)
+		case SetEnv:
+			err = setEnv(container, action)
+		case SetResources:
+			err = setResources(container, action)
+		case SetProbe:
+			err = setProbe(container, action)
+		default:
+			err = fmt.Errorf("%s is not a pod action", action.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %s: %v", i+1, action.Type, err)
+		}
+	}
+	return pod, nil
+}
+
+func findContainer(pod *corev1.Pod, name string) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == name {
+			return &pod.Spec.InitContainers[i]
+		}
+	}
+	return nil
+}
+
+func setImage(container *corev1.Container, action types.Action) error {
+	if action.Image == "" || strings.ContainsAny(action.Image, " \t\n") {
+		return fmt.Errorf("invalid image %q", action.Image)
+	}
+	if action.Image == container.Image {
+		return fmt.Errorf("container %s already uses the image %s", container.Name, action.Image)
+	}
+	container.Image = action.Image
+	return nil
+}
+
+func setEnv(container *corev1.Container, action types.Action) error {
+	if errs := validation.IsEnvVarName(action.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid environment variable name %q: %s", action.Name, strings.Join(errs, ", "))
+	}
+	for i, env := range container.Env {
+		if env.Name != action.Name {
+			continue
+		}
+		if env.ValueFrom != nil {
+			return fmt.Errorf("environment variable %s comes from a ConfigMap, a Secret or a field and cannot be set inline", action.Name)
+		}
+		if action.Value == "" {
+			container.Env = append(container.Env[:i:i], container.Env[i+1:]...)
+		} else {
+			container.Env[i].Value = action.Value
+		}
+		return nil
+	}
+	if action.Value == "" {
+		return fmt.Errorf("container %s has no environment variable %s to remove", container.Name, action.Name)
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: action.Name, Value: action.Value})
+	return nil
+}
+
+func setResources(container *corev1.Container, action types.Action) error {
+	set := func(list *corev1.ResourceList, name corev1.ResourceName, value string) error {
+		if value == "" {
+			return nil
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil || quantity.Sign() <= 0 {
+			return fmt.Errorf("invalid %s quantity %q", name, value)
+		}
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[name] = quantity
+		return nil
+	}
+	if action.CPURequest == "" && action.MemoryRequest == "" && action.CPULimit == "" && action.MemoryLimit == "" {
+		return fmt.Errorf("at least one of cpuRequest, memoryRequest, cpuLimit and memoryLimit is needed")
+	}
+	resources := &container.Resources
+	for _, err := range []error{
+		set(&resources.Requests, corev1.ResourceCPU, action.CPURequest),
+		set(&resources.Requests, corev1.ResourceMemory, action.MemoryRequest),
+		set(&resources.Limits, corev1.ResourceCPU, action.CPULimit),
+		set(&resources.Limits, corev1.ResourceMemory, action.MemoryLimit),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("the %s request %s of container %s is above its limit %s", name, request.String(), container.Name, limit.String())
+		}
+	}
+	return nil
+}
+
+func setProbe(container *corev1.Container, action types.Action) error {
+	probe := &corev1.Probe{
+		InitialDelaySeconds: action.InitialDelaySeconds,
+		PeriodSeconds:       action.PeriodSeconds,
+		TimeoutSeconds:      action.TimeoutSeconds,
+		FailureThreshold:    action.FailureThreshold,
+	}
+	switch {
+	case len(action.Command) > 0:
+		probe.Exec = &corev1.ExecAction{Command: action.Command}
+	case action.Port < 1 || action.Port > 65535:
+		return fmt.Errorf("a port between 1 and 65535 or a command is needed, got port %d", action.Port)
+	case action.HTTPPath != "":
+		if !strings.HasPrefix(action.HTTPPath, "/") {
+			return fmt.Errorf("the http path must start with /, got %q", action.HTTPPath)
+		}
+		probe.HTTPGet = &corev1.HTTPGetAction{Path: action.HTTPPath, Port: intstr.FromInt32(action.Port)}
+	default:
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: intstr.FromInt32(action.Port)}
+	}
+	if action.InitialDelaySeconds < 0 || action.PeriodSeconds < 0 || action.TimeoutSeconds < 0 || action.FailureThreshold < 0 {
+		return fmt.Errorf("the probe timings must not be negative")
+	}
+
+	switch action.Probe {
+	case "liveness":
+		container.LivenessProbe = probe
+	case "readiness":
+		container.ReadinessProbe = probe
+	case "startup":
+		container.StartupProbe = probe
+	default:
+		return fmt.Errorf("probe must be liveness, readiness or startup, got %q", action.Probe)
+	}
+	return nil
+}
+
+// Workload is the object owning the faulty pod that the workload actions are applied to
+type Workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Replicas is nil for the kinds that cannot be scaled
+	Replicas *int32
+	Template corev1.PodTemplateSpec
+	// Revision is the current revision of a Deployment and Revisions the pod templates of all its revisions
+	Revision  int64
+	Revisions map[int64]corev1.PodTemplateSpec
+}
+
+// Patch is a targeted patch of the workload
+type Patch struct {
+	Action string
+	// Type is the content type of the patch, MergePatch or JSONPatch
+	Type string
+	Data []byte
+	// Changes describe the patch for the risk scoring and the record
+	Changes []policy.Change
+	// TemplateChanges are the changes of the pod template, with the paths of a pod so that they are checked against
+	// the same whitelist as the pod remediations
+	TemplateChanges []policy.Change
+}
+
+// WorkloadPatches validates the workload actions and turns them into patches of the workload
+func WorkloadPatches(workload *Workload, actions []types.Action, now time.Time) ([]Patch, error) {
+	if workload == nil {
+		return nil, fmt.Errorf("the pod is not owned by a Deployment, a StatefulSet or a DaemonSet, only pod actions can be used")
+	}
+	var patches []Patch
+	for i, action := range actions {
+		patch, err := workloadPatch(workload, action, now)
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %s: %v", i+1, action.Type, err)
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+func workloadPatch(workload *Workload, action types.Action, now time.Time) (Patch, error) {
+	patch := Patch{Action: action.Type, Type: MergePatch}
+	var data interface{}
+	switch action.Type {
+	case Scale:
+		if workload.Replicas == nil {
+			return patch, fmt.Errorf("a %s cannot be scaled", workload.Kind)
+		}
+		if action.Replicas < 1 {
+			return patch, fmt.Errorf("the workload must keep at least one replica, got %d", action.Replicas)
+		}
+		if action.Replicas == *workload.Replicas {
+			return patch, fmt.Errorf("the %s already has %d replicas", workload.Kind, action.Replicas)
+		}
+		data = map[string]interface{}{"spec": map[string]interface{}{"replicas": action.Replicas}}
+		patch.Changes = []policy.Change{policy.NewChange([]string{"spec", "replicas"}, int64(*workload.Replicas), int64(action.Replicas))}
+	case Restart:
+		restartedAt := now.UTC().Format(time.RFC3339)
+		data = map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"annotations": map[string]interface{}{RestartedAtAnnotation: restartedAt}},
+		}}}
+		var old interface{}
+		if previous, ok := workload.Template.Annotations[RestartedAtAnnotation]; ok {
+			old = previous
+		}
+		patch.Changes = []policy.Change{policy.NewChange([]string{"spec", "template", "metadata", "annotations", RestartedAtAnnotation}, old, restartedAt)}
+	case RollbackToRevision:
+		if workload.Kind != "Deployment" {
+			return patch, fmt.Errorf("only Deployments can be rolled back, the pod is owned by a %s", workload.Kind)
+		}
+		if action.Revision == workload.Revision {
+			return patch, fmt.Errorf("revision %d is the current revision", action.Revision)
+		}
+		template, ok := workload.Revisions[action.Revision]
+		if !ok {
+			return patch, fmt.Errorf("the Deployment has no revision %d", action.Revision)
+		}
+		// like kubectl rollout undo, the template of the revision replaces the current one without the hash
+		// label of its ReplicaSet
+		template = *template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		patch.Type = JSONPatch
+		data = []map[string]interface{}{{"op": "replace", "path": "/spec/template", "value": template}}
+		patch.Changes = []policy.Change{policy.NewChange([]string{"spec", "template"},
+			fmt.Sprintf("revision %d", workload.Revision), fmt.Sprintf("revision %d", action.Revision))}
+		var err error
+		if patch.TemplateChanges, err = templateChanges(workload.Template, template); err != nil {
+			return patch, err
+		}
+	default:
+		return patch, fmt.Errorf("%s is not a workload action", action.Type)
+	}
+
+	var err error
+	if patch.Data, err = json.Marshal(data); err != nil {
+		return patch, fmt.Errorf("failed to encode the patch: %v", err)
+	}
+	return patch, nil
+}
+
+// templateChanges diffs two pod templates as pods. The restart annotation and the hash label of the ReplicaSets
+// are left out, restarting is an action of its own.
+func templateChanges(current, desired corev1.PodTemplateSpec) ([]policy.Change, error) {
+	asPod := func(template corev1.PodTemplateSpec) (map[string]interface{}, error) {
+		pod := &corev1.Pod{ObjectMeta: *template.ObjectMeta.DeepCopy(), Spec: template.Spec}
+		delete(pod.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		delete(pod.Annotations, RestartedAtAnnotation)
+		return runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	}
+	live, err := asPod(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the current template: %v", err)
+	}
+	target, err := asPod(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the template of the revision: %v", err)
+	}
+	return policy.Diff(live, target), nil
+}
+
+// RestorePatch returns the patch that restores the workload to the state it was in before the plan was applied
+func RestorePatch(workload *Workload) (Patch, error) {
+	ops := []map[string]interface{}{{"op": "replace", "path": "/spec/template", "value": workload.Template}}
+	if workload.Replicas != nil {
+		ops = append(ops, map[string]interface{}{"op": "replace", "path": "/spec/replicas", "value": *workload.Replicas})
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return Patch{}, fmt.Errorf("failed to encode the patch: %v", err)
+	}
+	return Patch{Action: "restore", Type: JSONPatch, Data: data}, nil
+}
@@ -0,0 +1,135 @@
+package plan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VedRatan/remediation-server/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Image: "nginx:latst",
+			Env: []corev1.EnvVar{
+				{Name: "MODE", Value: "prod"},
+				{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}}},
+			},
+		}}},
+	}
+}
+
+func TestSplit(t *testing.T) {
+	pod, workload, err := Split([]types.Action{{Type: SetImage}, {Type: SetEnv}}, AllActions)
+	assert.NoError(t, err)
+	assert.Len(t, pod, 2)
+	assert.Empty(t, workload)
+
+	_, _, err = Split([]types.Action{{Type: SetImage}, {Type: Restart}}, AllActions)
+	assert.ErrorContains(t, err, "must not mix")
+	_, _, err = Split([]types.Action{{Type: "deletePod"}}, AllActions)
+	assert.ErrorContains(t, err, "unknown type")
+	_, _, err = Split([]types.Action{{Type: Scale}}, []string{SetImage})
+	assert.ErrorContains(t, err, "not allowed")
+	_, _, err = Split(nil, AllActions)
+	assert.Error(t, err)
+}
+
+func TestApplyToPod(t *testing.T) {
+	original := testPod()
+	pod, err := ApplyToPod(original, []types.Action{
+		{Type: SetImage, Container: "app", Image: "nginx:1.27"},
+		{Type: SetEnv, Container: "app", Name: "MODE", Value: ""},
+		{Type: SetEnv, Container: "app", Name: "WORKERS", Value: "2"},
+		{Type: SetResources, Container: "app", MemoryRequest: "256Mi", MemoryLimit: "512Mi"},
+		{Type: SetProbe, Container: "app", Probe: "readiness", HTTPPath: "/healthz", Port: 8080, PeriodSeconds: 5},
+	})
+	require.NoError(t, err)
+
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "nginx:1.27", container.Image)
+	assert.Equal(t, []string{"TOKEN", "WORKERS"}, []string{container.Env[0].Name, container.Env[1].Name})
+	assert.Equal(t, "512Mi", container.Resources.Limits.Memory().String())
+	assert.Equal(t, "/healthz", container.ReadinessProbe.HTTPGet.Path)
+	assert.Equal(t, int32(5), container.ReadinessProbe.PeriodSeconds)
+	assert.Equal(t, "nginx:latst", original.Spec.Containers[0].Image, "the original pod must not be modified")
+
+	for name, action := range map[string]types.Action{
+		"unknown container":   {Type: SetImage, Container: "db", Image: "postgres:16"},
+		"same image":          {Type: SetImage, Container: "app", Image: "nginx:latst"},
+		"secret env":          {Type: SetEnv, Container: "app", Name: "TOKEN", Value: "abc"},
+		"invalid env name":    {Type: SetEnv, Container: "app", Name: "1MODE", Value: "x"},
+		"invalid quantity":    {Type: SetResources, Container: "app", MemoryLimit: "lots"},
+		"request above limit": {Type: SetResources, Container: "app", CPURequest: "2", CPULimit: "1"},
+		"no resources":        {Type: SetResources, Container: "app"},
+		"probe without port":  {Type: SetProbe, Container: "app", Probe: "liveness"},
+		"unknown probe":       {Type: SetProbe, Container: "app", Probe: "health", Port: 80},
+		"relative probe path": {Type: SetProbe, Container: "app", Probe: "liveness", Port: 80, HTTPPath: "healthz"},
+	} {
+		_, err := ApplyToPod(original, []types.Action{action})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWorkloadPatches(t *testing.T) {
+	three := int32(3)
+	workload := &Workload{
+		Kind:      "Deployment",
+		Namespace: "default",
+		Name:      "web",
+		Replicas:  &three,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "web:3"}}},
+		},
+		Revision: 3,
+		Revisions: map[int64]corev1.PodTemplateSpec{
+			2: {
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web", "pod-template-hash": "abc"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "web:2"}}},
+			},
+			3: {},
+		},
+	}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	patches, err := WorkloadPatches(workload, []types.Action{{Type: Scale, Replicas: 5}, {Type: Restart}, {Type: RollbackToRevision, Revision: 2}}, now)
+	require.NoError(t, err)
+	require.Len(t, patches, 3)
+	assert.Equal(t, MergePatch, patches[0].Type)
+	assert.JSONEq(t, `{"spec":{"replicas":5}}`, string(patches[0].Data))
+	assert.Equal(t, "spec.replicas: 3 -> 5", patches[0].Changes[0].String())
+	assert.JSONEq(t, `{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"2025-03-01T12:00:00Z"}}}}}`, string(patches[1].Data))
+	assert.Equal(t, JSONPatch, patches[2].Type)
+	assert.JSONEq(t, `[{"op":"replace","path":"/spec/template","value":{"metadata":{"creationTimestamp":null,"labels":{"app":"web"}},"spec":{"containers":[{"name":"app","image":"web:2","resources":{}}]}}}]`, string(patches[2].Data))
+	assert.Equal(t, "spec.template: revision 3 -> revision 2", patches[2].Changes[0].String())
+	// the template changes are checked against the whitelist of the pod remediations
+	require.Len(t, patches[2].TemplateChanges, 1)
+	assert.Equal(t, "spec.containers[app].image: web:3 -> web:2", patches[2].TemplateChanges[0].String())
+	assert.Empty(t, patches[1].TemplateChanges)
+
+	for name, action := range map[string]types.Action{
+		"scale to zero":    {Type: Scale, Replicas: 0},
+		"same replicas":    {Type: Scale, Replicas: 3},
+		"current revision": {Type: RollbackToRevision, Revision: 3},
+		"unknown revision": {Type: RollbackToRevision, Revision: 7},
+	} {
+		_, err := WorkloadPatches(workload, []types.Action{action}, now)
+		assert.Error(t, err, name)
+	}
+
+	_, err = WorkloadPatches(&Workload{Kind: "DaemonSet", Name: "agent"}, []types.Action{{Type: Scale, Replicas: 2}}, now)
+	assert.ErrorContains(t, err, "cannot be scaled")
+	_, err = WorkloadPatches(nil, []types.Action{{Type: Restart}}, now)
+	assert.Error(t, err)
+
+	restore, err := RestorePatch(workload)
+	require.NoError(t, err)
+	assert.Contains(t, string(restore.Data), `{"op":"replace","path":"/spec/replicas","value":3}`)
+}
@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a single difference between the live and the remediated object. Lists whose items all have a
+// name, ex: containers or env, are matched by name and show up as [name] in the path, other lists by index.
+type Change struct {
+	Path string
+	// Old is nil for added fields, New is nil for removed fields
+	Old interface{}
+	New interface{}
+
+	segments []segment
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Path, format(c.Old), format(c.New))
+}
+
+// NewChange returns the change of the field at the path, one field name per element. It describes the changes
+// that are not computed by Diff, ex: the patches of a workload.
+func NewChange(fields []string, old, new interface{}) Change {
+	segments := make([]segment, len(fields))
+	for i, field := range fields {
+		segments[i] = segment{field: field}
+	}
+	return Change{Path: pathOf(segments), Old: old, New: new, segments: segments}
+}
+
+// tokens returns the path in the form the allowed paths are matched against
+func (c Change) tokens() []string {
+	tokens := make([]string, len(c.segments))
+	for i, s := range c.segments {
+		tokens[i] = strings.TrimPrefix(s.String(), ".")
+	}
+	return tokens
+}
+
+func format(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return "{...}"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// segment is a field name, or a list item addressed by name (key) or by index
+type segment struct {
+	field string
+	key   string
+	index int
+	item  bool
+	named bool
+}
+
+func (s segment) String() string {
+	switch {
+	case !s.item:
+		return "." + s.field
+	case s.named:
+		return "[" + s.key + "]"
+	default:
+		return fmt.Sprintf("[%d]", s.index)
+	}
+}
+
+func pathOf(segments []segment) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteString(s.String())
+	}
+	return strings.TrimPrefix(b.String(), ".")
+}
+
+// Diff returns the changes that turn live into desired, both in their unstructured form.
+func Diff(live, desired map[string]interface{}) []Change {
+	var changes []Change
+	diff(nil, live, desired, &changes)
+	return changes
+}
+
+func diff(path []segment, a, b interface{}, out *[]Change) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			keys := map[string]bool{}
+			for k := range av {
+				keys[k] = true
+			}
+			for k := range bv {
+				keys[k] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				sorted = append(sorted, k)
+			}
+			sort.Strings(sorted)
+			for _, k := range sorted {
+				diff(appendSegment(path, segment{field: k}), av[k], bv[k], out)
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			diffList(path, av, bv, out)
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		segments := append([]segment(nil), path...)
+		*out = append(*out, Change{Path: pathOf(segments), Old: a, New: b, segments: segments})
+	}
+}
+
+func diffList(path []segment, a, b []interface{}, out *[]Change) {
+	if named(a) && named(b) {
+		bByName := map[string]interface{}{}
+		for _, item := range b {
+			bByName[nameOf(item)] = item
+		}
+		seen := map[string]bool{}
+		for _, item := range a {
+			name := nameOf(item)
+			seen[name] = true
+			diff(appendSegment(path, segment{item: true, named: true, key: name}), item, bByName[name], out)
+		}
+		for _, item := range b {
+			if name := nameOf(item); !seen[name] {
+				diff(appendSegment(path, segment{item: true, named: true, key: name}), nil, item, out)
+			}
+		}
+		return
+	}
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var av, bv interface{}
+		if i < len(a) {
+			av = a[i]
+		}
+		if i < len(b) {
+			bv = b[i]
+		}
+		diff(appendSegment(path, segment{item: true, index: i}), av, bv, out)
+	}
+}
+
+func appendSegment(path []segment, s segment) []segment {
+	out := make([]segment, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, s)
+}
+
+// named reports whether all items of the list are maps with a name
+func named(list []interface{}) bool {
+	for _, item := range list {
+		if nameOf(item) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func nameOf(item interface{}) string {
+	if m, ok := item.(map[string]interface{}); ok {
+		if name, ok := m["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Apply applies the changes to the object in place.
+func Apply(obj map[string]interface{}, changes []Change) error {
+	for _, change := range changes {
+		if len(change.segments) == 0 {
+			return fmt.Errorf("cannot apply a change of the whole object")
+		}
+		// the object is a map, so it is updated in place
+		if _, err := set(obj, change.segments, change.New); err != nil {
+			return fmt.Errorf("failed to apply the change of %s: %v", change.Path, err)
+		}
+	}
+	return nil
+}
+
+// set returns node with the value at path replaced, a nil value removes the field or list item
+func set(node interface{}, path []segment, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	s := path[0]
+	if !s.item {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			if node != nil {
+				return nil, fmt.Errorf("%s is not an object", s.field)
+			}
+			m = map[string]interface{}{}
+		}
+		child, err := set(m[s.field], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			delete(m, s.field)
+		} else {
+			m[s.field] = child
+		}
+		return m, nil
+	}
+
+	list, ok := node.([]interface{})
+	if !ok && node != nil {
+		return nil, fmt.Errorf("%s is not a list", s)
+	}
+	index := s.index
+	if s.named {
+		index = -1
+		for i, item := range list {
+			if nameOf(item) == s.key {
+				index = i
+			}
+		}
+	}
+	if index < 0 || index >= len(list) {
+		// a new item, added at the end of the list
+		if value == nil {
+			return list, nil
+		}
+		child, err := set(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return append(list, child), nil
+	}
+	child, err := set(list[index], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	if child == nil {
+		return append(list[:index:index], list[index+1:]...), nil
+	}
+	list[index] = child
+	return list, nil
+}
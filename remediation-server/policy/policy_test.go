@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func toMap(t *testing.T, pod *corev1.Pod) map[string]interface{} {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	require.NoError(t, err)
+	return obj
+}
+
+func testPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "sidecar", Image: "envoy:1.30"},
+			{Name: "app", Image: "nginx:latst", Env: []corev1.EnvVar{{Name: "MODE", Value: "prod"}}},
+		}},
+	}
+}
+
+func TestDiffAndPrune(t *testing.T) {
+	live := testPod()
+	desired := live.DeepCopy()
+	// the model reordered the containers, which must not show up as a change
+	desired.Spec.Containers[0], desired.Spec.Containers[1] = desired.Spec.Containers[1], desired.Spec.Containers[0]
+	desired.Spec.Containers[0].Image = "nginx:1.27"
+	desired.Spec.Containers[0].Env = append(desired.Spec.Containers[0].Env, corev1.EnvVar{Name: "WORKERS", Value: "2"})
+	desired.Spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}
+	desired.Labels["app"] = "api"
+	desired.Spec.HostNetwork = true
+
+	changes := Diff(toMap(t, live), toMap(t, desired))
+	assert.ElementsMatch(t, []string{
+		"metadata.labels.app",
+		"spec.containers[app].env[WORKERS]",
+		"spec.containers[app].image",
+		"spec.containers[app].resources.limits",
+		"spec.hostNetwork",
+	}, Paths(changes))
+
+	whitelist, err := NewWhitelist(DefaultAllowedChanges)
+	require.NoError(t, err)
+	allowed, disallowed := whitelist.Partition(changes)
+	assert.ElementsMatch(t, []string{"spec.containers[app].env[WORKERS]", "spec.containers[app].image", "spec.containers[app].resources.limits"}, Paths(allowed))
+	assert.ElementsMatch(t, []string{"metadata.labels.app", "spec.hostNetwork"}, Paths(disallowed))
+
+	pruned := toMap(t, live)
+	require.NoError(t, Apply(pruned, allowed))
+	var result corev1.Pod
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(pruned, &result))
+	assert.Equal(t, "web", result.Labels["app"])
+	assert.False(t, result.Spec.HostNetwork)
+	assert.Equal(t, "envoy:1.30", result.Spec.Containers[0].Image)
+	assert.Equal(t, "nginx:1.27", result.Spec.Containers[1].Image)
+	assert.Equal(t, []corev1.EnvVar{{Name: "MODE", Value: "prod"}, {Name: "WORKERS", Value: "2"}}, result.Spec.Containers[1].Env)
+	assert.Equal(t, "256Mi", result.Spec.Containers[1].Resources.Limits.Memory().String())
+}
+
+func TestApplyRemovals(t *testing.T) {
+	live := testPod()
+	desired := live.DeepCopy()
+	desired.Spec.Containers[1].Env = nil
+	desired.Spec.Containers = desired.Spec.Containers[1:]
+
+	changes := Diff(toMap(t, live), toMap(t, desired))
+	assert.ElementsMatch(t, []string{"spec.containers[sidecar]", "spec.containers[app].env"}, Paths(changes))
+
+	obj := toMap(t, live)
+	require.NoError(t, Apply(obj, changes))
+	assert.Empty(t, Diff(obj, toMap(t, desired)))
+}
+
+func TestWhitelist(t *testing.T) {
+	whitelist, err := NewWhitelist([]string{"spec.containers[*].image", "metadata.annotations.*"})
+	require.NoError(t, err)
+	for path, allowed := range map[string]bool{
+		"spec.containers[app].image":     true,
+		"spec.containers[0].image":       true,
+		"spec.containers[app].imageTag":  false,
+		"spec.containers[app]":           false,
+		"spec.initContainers[app].image": false,
+		"metadata.annotations.team":      true,
+		"metadata.annotations":           false,
+		"metadata.labels.team":           false,
+		"spec.containers.image":          false,
+	} {
+		var segments []segment
+		for _, token := range tokenize(path) {
+			if token[0] == '[' {
+				segments = append(segments, segment{item: true, named: true, key: token[1 : len(token)-1]})
+			} else {
+				segments = append(segments, segment{field: token})
+			}
+		}
+		assert.Equal(t, allowed, whitelist.Allowed(Change{Path: path, segments: segments}), path)
+	}
+
+	for _, invalid := range []string{"spec..image", "spec.containers[*"} {
+		_, err := NewWhitelist([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRiskScorer(t *testing.T) {
+	scorer, err := NewRiskScorer(RiskConfig{
+		PathWeights:      DefaultPathWeights,
+		NamespaceWeights: map[string]float64{"kube-system": 3, "*": 1},
+		AutoApplyBelow:   4,
+		RefuseAbove:      10,
+	})
+	require.NoError(t, err)
+
+	live := testPod()
+	resources := live.DeepCopy()
+	resources.Spec.Containers[1].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}
+	image := resources.DeepCopy()
+	image.Spec.Containers[1].Image = "nginx:1.27"
+	command := image.DeepCopy()
+	command.Spec.Containers[1].Command = []string{"nginx", "-g", "daemon off;"}
+	command.Spec.Containers[0].Command = []string{"envoy"}
+	command.Spec.DNSPolicy = corev1.DNSDefault
+
+	for _, tc := range []struct {
+		name      string
+		namespace string
+		desired   *corev1.Pod
+		score     float64
+		decision  string
+	}{
+		{name: "resources", namespace: "default", desired: resources, score: 1, decision: DecisionAutoApply},
+		{name: "resources in kube-system", namespace: "kube-system", desired: resources, score: 3, decision: DecisionAutoApply},
+		{name: "image", namespace: "default", desired: image, score: 4, decision: DecisionApproval},
+		{name: "image in kube-system", namespace: "kube-system", desired: image, score: 12, decision: DecisionRefuse},
+		{name: "commands and unknown fields", namespace: "default", desired: command, score: 19, decision: DecisionRefuse},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assessment := scorer.Assess(tc.namespace, Diff(toMap(t, live), toMap(t, tc.desired)))
+			assert.Equal(t, tc.score, assessment.Score)
+			assert.Equal(t, tc.decision, assessment.Decision)
+			assert.NotEmpty(t, assessment.Reasons)
+		})
+	}
+
+	_, err = NewRiskScorer(RiskConfig{AutoApplyBelow: 5, RefuseAbove: 1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultPathWeights rank the changes from the safest, a resource bump, to the riskiest, a new command. The
+// spec.template and spec.replicas paths weigh the restarts, scales and rollbacks of workloads.
+var DefaultPathWeights = map[string]float64{
+	"spec.containers[*].resources":      1,
+	"spec.initContainers[*].resources":  1,
+	"spec.containers[*].livenessProbe":  2,
+	"spec.containers[*].readinessProbe": 2,
+	"spec.containers[*].startupProbe":   2,
+	"spec.containers[*].env":            2,
+	"spec.initContainers[*].env":        2,
+	"spec.containers[*].image":          3,
+	"spec.initContainers[*].image":      3,
+	"spec.containers[*].command":        5,
+	"spec.containers[*].args":           5,
+	"spec.initContainers[*].command":    5,
+	"spec.initContainers[*].args":       5,
+	"*":                                 5,
+}
+
+// Risk decisions
+const (
+	DecisionAutoApply = "AutoApply"
+	DecisionApproval  = "RequireApproval"
+	DecisionRefuse    = "Refuse"
+)
+
+// RiskConfig weighs the changes of a remediation. The score of a remediation is the sum of the weights of its
+// changes, each weighted by the most specific matching path, multiplied by the weight of the namespace.
+type RiskConfig struct {
+	// PathWeights use the syntax of the allowed paths, the "*" key is used for the changes no path matches
+	PathWeights map[string]float64
+	// NamespaceWeights multiply the score of the remediations in a namespace, the "*" key defaults to 1
+	NamespaceWeights map[string]float64
+	// Scores below AutoApplyBelow are applied right away, scores above RefuseAbove are refused and those in
+	// between wait for an approval
+	AutoApplyBelow float64
+	RefuseAbove    float64
+}
+
+// Assessment is the risk of a remediation and the reasons behind it
+type Assessment struct {
+	Score    float64
+	Reasons  []string
+	Decision string
+}
+
+type weightedPattern struct {
+	tokens []string
+	weight float64
+}
+
+type RiskScorer struct {
+	patterns      []weightedPattern
+	defaultWeight float64
+	config        RiskConfig
+}
+
+func NewRiskScorer(config RiskConfig) (*RiskScorer, error) {
+	if config.RefuseAbove < config.AutoApplyBelow {
+		return nil, fmt.Errorf("the refuse threshold %g is below the auto-apply threshold %g", config.RefuseAbove, config.AutoApplyBelow)
+	}
+	r := &RiskScorer{config: config, defaultWeight: config.PathWeights["*"]}
+	for path, weight := range config.PathWeights {
+		if path == "*" {
+			continue
+		}
+		whitelist, err := NewWhitelist([]string{path})
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, weightedPattern{tokens: whitelist.patterns[0], weight: weight})
+	}
+	return r, nil
+}
+
+// Assess scores the changes of a remediation in the namespace
+func (r *RiskScorer) Assess(namespace string, changes []Change) Assessment {
+	var a Assessment
+	for _, change := range changes {
+		weight := r.weight(change)
+		a.Score += weight
+		a.Reasons = append(a.Reasons, fmt.Sprintf("%s +%g", change.Path, weight))
+	}
+	multiplier, ok := r.config.NamespaceWeights[namespace]
+	if !ok {
+		multiplier, ok = r.config.NamespaceWeights["*"]
+	}
+	if ok && multiplier != 1 {
+		a.Score *= multiplier
+		a.Reasons = append(a.Reasons, fmt.Sprintf("namespace %s x%g", namespace, multiplier))
+	}
+
+	switch {
+	case a.Score < r.config.AutoApplyBelow:
+		a.Decision = DecisionAutoApply
+	case a.Score > r.config.RefuseAbove:
+		a.Decision = DecisionRefuse
+	default:
+		a.Decision = DecisionApproval
+	}
+	return a
+}
+
+// weight returns the weight of the most specific path matching the change
+func (r *RiskScorer) weight(change Change) float64 {
+	tokens := change.tokens()
+	weight, longest := r.defaultWeight, -1
+	for _, pattern := range r.patterns {
+		if len(pattern.tokens) > longest && matches(pattern.tokens, tokens) {
+			weight, longest = pattern.weight, len(pattern.tokens)
+		}
+	}
+	return weight
+}
+
+func (a Assessment) String() string {
+	return fmt.Sprintf("%s (score %g: %s)", a.Decision, a.Score, strings.Join(a.Reasons, ", "))
+}
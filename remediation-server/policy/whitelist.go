@@ -0,0 +1,141 @@
+// Package policy decides which changes of a remediation are allowed to reach the cluster.
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultAllowedChanges are the paths a remediation may change by default, the container images, commands,
+// environment, resources and probes
+var DefaultAllowedChanges = []string{
+	"spec.containers[*].image",
+	"spec.containers[*].command",
+	"spec.containers[*].args",
+	"spec.containers[*].env",
+	"spec.containers[*].resources",
+	"spec.containers[*].livenessProbe",
+	"spec.containers[*].readinessProbe",
+	"spec.containers[*].startupProbe",
+	"spec.initContainers[*].image",
+	"spec.initContainers[*].command",
+	"spec.initContainers[*].args",
+	"spec.initContainers[*].env",
+	"spec.initContainers[*].resources",
+}
+
+// Disallowed change modes
+const (
+	// ModeReject rejects the whole proposal, the reason is fed back to the ai backend
+	ModeReject = "reject"
+	// ModePrune drops the disallowed changes and applies the allowed ones
+	ModePrune = "prune"
+)
+
+// Whitelist matches changes against the allowed paths. A path matches its own changes and those of every field
+// below it, [*] matches any list item and * any field.
+type Whitelist struct {
+	patterns [][]string
+}
+
+// NewWhitelist parses the allowed paths, ex: spec.containers[*].image
+func NewWhitelist(paths []string) (*Whitelist, error) {
+	w := &Whitelist{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		tokens := tokenize(path)
+		for _, token := range tokens {
+			if token == "" || token == "[]" {
+				return nil, fmt.Errorf("invalid allowed path %q", path)
+			}
+		}
+		w.patterns = append(w.patterns, tokens)
+	}
+	return w, nil
+}
+
+// Allowed reports whether the change is covered by one of the allowed paths
+func (w *Whitelist) Allowed(change Change) bool {
+	tokens := change.tokens()
+	for _, pattern := range w.patterns {
+		if matches(pattern, tokens) {
+			return true
+		}
+	}
+	return false
+}
+
+// Partition splits the changes into the allowed and the disallowed ones
+func (w *Whitelist) Partition(changes []Change) (allowed, disallowed []Change) {
+	for _, change := range changes {
+		if w.Allowed(change) {
+			allowed = append(allowed, change)
+		} else {
+			disallowed = append(disallowed, change)
+		}
+	}
+	return allowed, disallowed
+}
+
+func matches(pattern, tokens []string) bool {
+	if len(pattern) > len(tokens) {
+		return false
+	}
+	for i, p := range pattern {
+		switch {
+		case p == "[*]":
+			if !strings.HasPrefix(tokens[i], "[") {
+				return false
+			}
+		case p == "*":
+			if strings.HasPrefix(tokens[i], "[") {
+				return false
+			}
+		case p != tokens[i]:
+			return false
+		}
+	}
+	return true
+}
+
+// tokenize splits a path into its fields and list items, ex: spec.containers[*].image becomes
+// spec, containers, [*], image
+func tokenize(path string) []string {
+	var tokens []string
+	for _, field := range strings.Split(path, ".") {
+		if field == "" {
+			tokens = append(tokens, "")
+			continue
+		}
+		for field != "" {
+			open := strings.IndexByte(field, '[')
+			if open < 0 {
+				tokens = append(tokens, field)
+				break
+			}
+			if open > 0 {
+				tokens = append(tokens, field[:open])
+			}
+			end := strings.IndexByte(field[open:], ']')
+			if end < 0 {
+				tokens = append(tokens, "")
+				break
+			}
+			tokens = append(tokens, field[open:open+end+1])
+			field = field[open+end+1:]
+		}
+	}
+	return tokens
+}
+
+// Paths returns the paths of the changes
+func Paths(changes []Change) []string {
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		paths[i] = change.Path
+	}
+	return paths
+}
@@ -0,0 +1,243 @@
+package prompt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultTemplate is used when no template of the ConfigMap matches the faulty object.
+const DefaultTemplate = `{{ .Result.Spec.Details }}
+
+{{ .Kind }} YAML:
+{{ .Object }}
+{{- if .Owner }}
+
+The {{ .Kind }} is owned by {{ .Owner }}.
+{{- end }}
+{{- if .Workload }}
+
+The {{ .Kind | lower }} belongs to {{ .Workload }}.
+{{- range .Revisions }}
+{{ . }}
+{{- end }}
+{{- end }}
+{{- if .Constraints }}
+
+The namespace has resource constraints, the requests and limits of the {{ .Kind | lower }} must fit them:
+{{- range .Constraints }}
+{{ . }}
+{{- end }}
+{{- end }}
+{{- if .Events }}
+
+Recent events:
+{{- range .Events }}
+{{ . }}
+{{- end }}
+{{- end }}
+{{- range .Logs }}
+
+Logs of container {{ .Container }}{{ if .Previous }} (previous instance){{ end }}:
+{{ .Logs }}
+{{- end }}
+
+Generate a remediation plan for the above faulty {{ .Kind }}. Prefer the smallest change that fixes the root cause and don't change anything unrelated to it.`
+
+// ResponseFormat is appended to every rendered prompt, it describes the structured answer expected from the
+// ai backends so custom templates only need to describe the problem and the team's instructions.
+const ResponseFormat = `Respond only with a JSON object with the following fields:
+- "actions": the remediation plan, a list of actions applied in order. Each action has a "type" and the fields of that type:
+  - "setImage": "container", "image"
+  - "setEnv": "container", "name", "value" (an empty value removes the variable)
+  - "setResources": "container" and any of "cpuRequest", "memoryRequest", "cpuLimit", "memoryLimit", ex: "250m", "512Mi"
+  - "setProbe": "container", "probe" (liveness, readiness or startup), "httpPath" and "port", or "command", or only "port" for a TCP check, and optionally "initialDelaySeconds", "periodSeconds", "timeoutSeconds", "failureThreshold"
+  - "rollbackToRevision": "revision", rolls the owning Deployment back to one of its revisions
+  - "scale": "replicas", scales the owning Deployment or StatefulSet
+  - "restart": restarts the pods of the owning workload
+  Actions on the pod (setImage, setEnv, setResources, setProbe) must not be combined with actions on the owning workload (rollbackToRevision, scale, restart).
+- "explanation": a short explanation of the root cause and of the fix
+- "confidence": your confidence that the fix resolves the problem, a number between 0 and 1`
+
+// Repair builds the follow-up turn sent to the ai backend when its previous answer was rejected
+func Repair(reason string) string {
+	return fmt.Sprintf("Your previous answer was rejected: %s\n\nFix the problem and respond again with the complete JSON object.", reason)
+}
+
+// FixFailed builds the follow-up turn sent to the ai backend when its fix was applied but did not work
+func FixFailed(report string) string {
+	return fmt.Sprintf("Your fix was applied but it did not work, here is what happened:\n\n%s\nPropose a different fix and respond again with the complete JSON object.", report)
+}
+
+var configMapGVR = schema.GroupVersionResource{
+	Group:    "",
+	Version:  "v1",
+	Resource: "configmaps",
+}
+
+var funcs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"join":  strings.Join,
+}
+
+// Data is handed to the prompt templates.
+type Data struct {
+	Result    *k8sgptv1alpha1.Result
+	Kind      string
+	Namespace string
+	Name      string
+	// Object is the faulty object serialized as YAML
+	Object string
+	// Owner is the controller of the object in Kind/name form, empty for bare objects
+	Owner string
+	// Workload is the Deployment, StatefulSet or DaemonSet the object belongs to in Kind/name form and Revisions
+	// describe the revisions of a Deployment, ex: revision 2: app=nginx:1.27
+	Workload  string
+	Revisions []string
+	// Constraints describe the ResourceQuotas and LimitRanges of the namespace, ex: ResourceQuota compute:
+	// limits.memory 768Mi available of 2Gi
+	Constraints []string
+	// Events are the Warning events of the object and of its owner, oldest first
+	Events []string
+	// Logs of the failing containers, truncated to the configured budget
+	Logs []ContainerLogs
+}
+
+// ContainerLogs are the logs of a single container
+type ContainerLogs struct {
+	Container string
+	// Previous is set for the logs of the previous instance of a restarted container
+	Previous bool
+	Logs     string
+}
+
+// Store holds the prompt templates. The templates are looked up by the keys of the ConfigMap, from the
+// most to the least specific one:
+//
+//	namespace.<namespace>.kind.<kind>.tmpl
+//	namespace.<namespace>.tmpl
+//	kind.<kind>.tmpl
+//	default.tmpl
+//
+// kinds are lower case, ex: kind.pod.tmpl. If none of them is present the built-in DefaultTemplate is used.
+type Store struct {
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+	fallback  *template.Template
+	logger    *zap.Logger
+}
+
+func NewStore(logger *zap.Logger) *Store {
+	return &Store{
+		templates: map[string]*template.Template{},
+		fallback:  template.Must(template.New("builtin").Funcs(funcs).Parse(DefaultTemplate)),
+		logger:    logger,
+	}
+}
+
+// Load parses the given templates and replaces the current ones. If any of them fails to parse the
+// current templates are kept, so a broken edit of the ConfigMap never leaves the controller without prompts.
+func (s *Store) Load(data map[string]string) error {
+	templates := make(map[string]*template.Template, len(data))
+	for key, text := range data {
+		if !strings.HasSuffix(key, ".tmpl") {
+			continue
+		}
+		tmpl, err := template.New(key).Funcs(funcs).Parse(text)
+		if err != nil {
+			return fmt.Errorf("failed to parse prompt template %s: %v", key, err)
+		}
+		templates[key] = tmpl
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates = templates
+	return nil
+}
+
+// Render executes the most specific template for the kind and namespace of the faulty object.
+func (s *Store) Render(data Data) (string, error) {
+	tmpl := s.lookup(strings.ToLower(data.Kind), data.Namespace)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %v", tmpl.Name(), err)
+	}
+	buf.WriteString("\n\n")
+	buf.WriteString(ResponseFormat)
+	return buf.String(), nil
+}
+
+func (s *Store) lookup(kind, namespace string) *template.Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range []string{
+		fmt.Sprintf("namespace.%s.kind.%s.tmpl", namespace, kind),
+		fmt.Sprintf("namespace.%s.tmpl", namespace),
+		fmt.Sprintf("kind.%s.tmpl", kind),
+		"default.tmpl",
+	} {
+		if tmpl, ok := s.templates[key]; ok {
+			return tmpl
+		}
+	}
+	return s.fallback
+}
+
+// Watch keeps the templates in sync with the given ConfigMap until the context is done. Deleting the
+// ConfigMap falls back to the built-in template.
+func (s *Store) Watch(ctx context.Context, client dynamic.Interface, namespace, name string) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 10*time.Minute, namespace, func(opts *metav1.ListOptions) {
+		opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	})
+	informer := factory.ForResource(configMapGVR).Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.handleConfigMap,
+		UpdateFunc: func(_, obj interface{}) { s.handleConfigMap(obj) },
+		DeleteFunc: func(obj interface{}) {
+			s.logger.Info("prompt configmap deleted, using the built-in template", zap.String("name", namespace+"/"+name))
+			_ = s.Load(nil)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error in registering prompt configmap event handler: %v", err)
+	}
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to wait for prompt configmap cache sync")
+	}
+	return nil
+}
+
+func (s *Store) handleConfigMap(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	var cm corev1.ConfigMap
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &cm); err != nil {
+		s.logger.Error("failed to convert unstructured obj to *corev1.ConfigMap", zap.Error(err))
+		return
+	}
+	if err := s.Load(cm.Data); err != nil {
+		s.logger.Error("failed to reload prompt templates, keeping the previous ones", zap.Error(err))
+		return
+	}
+	s.logger.Info("prompt templates reloaded", zap.String("name", cm.Namespace+"/"+cm.Name), zap.Int("templates", len(cm.Data)))
+}
@@ -0,0 +1,54 @@
+package prompt
+
+import (
+	"testing"
+
+	k8sgptv1alpha1 "github.com/k8sgpt-ai/k8sgpt-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRender(t *testing.T) {
+	s := NewStore(zap.NewNop())
+	data := Data{
+		Result:      &k8sgptv1alpha1.Result{Spec: k8sgptv1alpha1.ResultSpec{Details: "Pod is crash looping"}},
+		Kind:        "Pod",
+		Namespace:   "team-a",
+		Name:        "faulty-pod",
+		Object:      "kind: Pod",
+		Events:      []string{"Warning BackOff: Back-off restarting failed container"},
+		Workload:    "Deployment/web",
+		Revisions:   []string{"revision 2: app=nginx:1.26", "revision 3 (current): app=nginx:latst"},
+		Constraints: []string{"ResourceQuota compute: limits.memory 768Mi available of 2Gi"},
+	}
+
+	out, err := s.Render(data)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Pod is crash looping")
+	assert.Contains(t, out, "Warning BackOff")
+	assert.Contains(t, out, "belongs to Deployment/web.\nrevision 2: app=nginx:1.26\nrevision 3 (current)")
+	assert.Contains(t, out, "must fit them:\nResourceQuota compute: limits.memory 768Mi available of 2Gi")
+	assert.Contains(t, out, "remediation plan for the above faulty Pod")
+
+	assert.NoError(t, s.Load(map[string]string{
+		"default.tmpl":                    "default",
+		"kind.pod.tmpl":                   "kind",
+		"namespace.team-a.tmpl":           "namespace",
+		"namespace.team-a.kind.pod.tmpl":  "never change images for {{ .Name }}",
+		"namespace.team-b.kind.node.tmpl": "unused",
+	}))
+	out, err = s.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "never change images for faulty-pod\n\n"+ResponseFormat, out)
+
+	data.Namespace = "team-c"
+	out, err = s.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "kind\n\n"+ResponseFormat, out)
+
+	// a broken template keeps the previously loaded ones
+	assert.Error(t, s.Load(map[string]string{"default.tmpl": "{{ .Name "}))
+	out, err = s.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "kind\n\n"+ResponseFormat, out)
+}
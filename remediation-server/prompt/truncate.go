@@ -0,0 +1,106 @@
+package prompt
+
+import (
+	"regexp"
+	"strings"
+)
+
+const truncatedMarker = "... [truncated] ..."
+
+// stackTraceStart matches the first line of the stack traces of the common runtimes
+var stackTraceStart = regexp.MustCompile(`^(panic:|fatal error:|goroutine \d+ \[|Traceback \(most recent call last\)|Exception in thread|Caused by:|\S+(Exception|Error): )`)
+
+// Truncate shortens the text to about budget bytes. The most recent lines are kept, and if the last stack trace
+// of the text falls outside of them, the beginning of it is kept as well since it usually explains the crash. A
+// last line longer than the budget is cut.
+func Truncate(text string, budget int) string {
+	if budget <= 0 || len(text) <= budget {
+		return text
+	}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	var trace []string
+	if start := lastTrace(lines); start >= 0 {
+		trace = lines[start:]
+	}
+	traceBudget := 0
+	if len(trace) > 0 {
+		traceBudget = budget / 2
+	}
+
+	tail := tailLines(lines, budget-traceBudget)
+	if len(tail) == 0 {
+		tail = []string{strings.ToValidUTF8(lines[len(lines)-1][:budget-traceBudget], "")}
+	}
+	if len(trace) <= len(tail) {
+		// the stack trace is part of the most recent lines already
+		return truncatedMarker + "\n" + strings.Join(tail, "\n")
+	}
+	head := headLines(trace[:len(trace)-len(tail)], traceBudget)
+	return truncatedMarker + "\n" + strings.Join(head, "\n") + "\n" + truncatedMarker + "\n" + strings.Join(tail, "\n")
+}
+
+// lastTrace returns the index of the first line of the last stack trace, -1 if there is none. The trace is walked
+// back from its last start line, ex: a Caused by: or the dump of another goroutine, over its frames: the blank and
+// indented lines and the lines followed by an indented one, ex: the function of a Go frame.
+func lastTrace(lines []string) int {
+	start := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if stackTraceStart.MatchString(lines[i]) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return -1
+	}
+	for i := start - 1; i >= 0; i-- {
+		line := lines[i]
+		switch {
+		case stackTraceStart.MatchString(line):
+			start = i
+		case strings.TrimSpace(line) == "", indented(line), indented(lines[i+1]):
+		default:
+			return start
+		}
+	}
+	return start
+}
+
+func indented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// TruncateLines keeps the most recent lines that fit into budget bytes.
+func TruncateLines(lines []string, budget int) []string {
+	if budget <= 0 {
+		return lines
+	}
+	tail := tailLines(lines, budget)
+	if len(tail) < len(lines) {
+		return append([]string{truncatedMarker}, tail...)
+	}
+	return lines
+}
+
+func tailLines(lines []string, budget int) []string {
+	size := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		size += len(lines[i]) + 1
+		if size > budget {
+			return lines[i+1:]
+		}
+	}
+	return lines
+}
+
+func headLines(lines []string, budget int) []string {
+	size := 0
+	for i, line := range lines {
+		size += len(line) + 1
+		if size > budget {
+			return lines[:i]
+		}
+	}
+	return lines
+}
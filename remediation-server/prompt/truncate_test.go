@@ -0,0 +1,44 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", Truncate("short", 100))
+
+	var logs []string
+	for i := 0; i < 100; i++ {
+		logs = append(logs, fmt.Sprintf("line %03d", i))
+	}
+	out := Truncate(strings.Join(logs, "\n"), 100)
+	assert.LessOrEqual(t, len(out), 100+len(truncatedMarker)+1)
+	assert.True(t, strings.HasSuffix(out, "line 099"))
+	assert.NotContains(t, out, "line 000")
+
+	// the stack trace is kept even though it is followed by a lot of noise
+	withTrace := append([]string{"starting", "panic: runtime error: invalid memory address", "goroutine 1 [running]:", "main.main()"}, logs...)
+	out = Truncate(strings.Join(withTrace, "\n"), 200)
+	assert.Contains(t, out, "panic: runtime error")
+	assert.NotContains(t, out, "starting")
+	assert.True(t, strings.HasSuffix(out, "line 099"))
+
+	// the most recent stack trace is kept from its first line, the goroutines it dumps are part of it
+	restarted := append(append(append([]string{}, withTrace...), "panic: assignment to entry in nil map", "",
+		"goroutine 1 [running]:", "main.main()", "\t/app/main.go:12 +0x1d", "", "goroutine 7 [select]:", "main.worker()",
+		"\t/app/worker.go:30 +0x2a"), logs...)
+	out = Truncate(strings.Join(restarted, "\n"), 200)
+	assert.Contains(t, out, "panic: assignment to entry in nil map")
+	assert.NotContains(t, out, "invalid memory address")
+	assert.True(t, strings.HasSuffix(out, "line 099"))
+
+	// a last line over the budget is cut rather than dropped
+	out = Truncate("first\n"+strings.Repeat("x", 300), 100)
+	assert.Equal(t, truncatedMarker+"\n"+strings.Repeat("x", 100), out)
+
+	assert.Equal(t, []string{truncatedMarker, "line 098", "line 099"}, TruncateLines(logs, 18))
+}
@@ -0,0 +1,305 @@
+// Package quota checks the requests and limits of a remediated pod against the ResourceQuotas and LimitRanges of
+// its namespace. The faulty pod is deleted before the remediated one is created, so a violation only shows up once
+// the original pod is gone. The usage of the pod being replaced is released from the quotas before the check.
+package quota
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/VedRatan/remediation-server/scheduling"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ViolationError is returned by Check with the constraints the pod violates
+type ViolationError struct {
+	Reasons []string
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("the pod does not fit the resource constraints of its namespace: %s", strings.Join(e.Reasons, "; "))
+}
+
+// Check returns a *ViolationError if the pod exceeds the headroom of a quota or the bounds of a LimitRange. The
+// replaced pod may be nil, its usage is released from the quotas.
+func Check(pod, replaced *corev1.Pod, quotas []corev1.ResourceQuota, limitRanges []corev1.LimitRange) error {
+	var reasons []string
+	for i := range quotas {
+		reasons = append(reasons, checkQuota(pod, replaced, &quotas[i])...)
+	}
+	for i := range limitRanges {
+		reasons = append(reasons, checkLimitRange(pod, &limitRanges[i])...)
+	}
+	if len(reasons) > 0 {
+		return &ViolationError{Reasons: reasons}
+	}
+	return nil
+}
+
+// Describe returns the constraints of the namespace as lines for the prompt, the headroom of the quotas includes
+// the usage of the replaced pod
+func Describe(replaced *corev1.Pod, quotas []corev1.ResourceQuota, limitRanges []corev1.LimitRange) []string {
+	var lines []string
+	for i := range quotas {
+		quota := &quotas[i]
+		var items []string
+		for _, name := range sortedNames(quota.Spec.Hard) {
+			if !isComputeResource(name) {
+				continue
+			}
+			hard := quota.Spec.Hard[name]
+			headroom := headroom(replaced, quota, name)
+			items = append(items, fmt.Sprintf("%s %s available of %s", name, headroom.String(), hard.String()))
+		}
+		if len(items) > 0 {
+			lines = append(lines, fmt.Sprintf("ResourceQuota %s: %s", quota.Name, strings.Join(items, ", ")))
+		}
+	}
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer && item.Type != corev1.LimitTypePod {
+				continue
+			}
+			var bounds []string
+			for _, bound := range []struct {
+				name string
+				list corev1.ResourceList
+			}{
+				{"min", item.Min},
+				{"max", item.Max},
+				{"default limits", item.Default},
+				{"default requests", item.DefaultRequest},
+				{"max limit/request ratio", item.MaxLimitRequestRatio},
+			} {
+				if len(bound.list) > 0 {
+					bounds = append(bounds, fmt.Sprintf("%s %s", bound.name, formatList(bound.list)))
+				}
+			}
+			if len(bounds) > 0 {
+				lines = append(lines, fmt.Sprintf("LimitRange %s per %s: %s", limitRange.Name, item.Type, strings.Join(bounds, ", ")))
+			}
+		}
+	}
+	return lines
+}
+
+// checkQuota compares the usage of the pod with the headroom of the quota
+func checkQuota(pod, replaced *corev1.Pod, quota *corev1.ResourceQuota) []string {
+	if !matchesScopes(pod, quota) {
+		return nil
+	}
+	var reasons []string
+	usage := podUsage(pod)
+	for _, name := range sortedNames(quota.Spec.Hard) {
+		if !isComputeResource(name) {
+			continue
+		}
+		if missing := unspecified(pod, name); len(missing) > 0 {
+			reasons = append(reasons, fmt.Sprintf("the ResourceQuota %s tracks %s, it must be set on the containers %s", quota.Name, name, strings.Join(missing, ", ")))
+			continue
+		}
+		requested, ok := usage[name]
+		if !ok {
+			continue
+		}
+		if headroom := headroom(replaced, quota, name); requested.Cmp(headroom) > 0 {
+			hard := quota.Spec.Hard[name]
+			reasons = append(reasons, fmt.Sprintf("the ResourceQuota %s allows %s of %s and %s is available, the pod needs %s",
+				quota.Name, hard.String(), name, headroom.String(), requested.String()))
+		}
+	}
+	return reasons
+}
+
+// headroom is the amount of the resource left in the quota once the replaced pod is deleted
+func headroom(replaced *corev1.Pod, quota *corev1.ResourceQuota, name corev1.ResourceName) resource.Quantity {
+	free := quota.Spec.Hard[name].DeepCopy()
+	free.Sub(quota.Status.Used[name])
+	if replaced != nil && replaced.Status.Phase != corev1.PodSucceeded && replaced.Status.Phase != corev1.PodFailed && matchesScopes(replaced, quota) {
+		free.Add(podUsage(replaced)[name])
+	}
+	if free.Sign() < 0 {
+		return resource.Quantity{Format: free.Format}
+	}
+	return free
+}
+
+// podUsage returns the quota usage of the pod, named after the quota resources, ex: requests.memory
+func podUsage(pod *corev1.Pod) corev1.ResourceList {
+	usage := corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}
+	for name, quantity := range scheduling.PodRequests(pod) {
+		usage[corev1.ResourceName("requests."+string(name))] = quantity
+		if name == corev1.ResourceCPU || name == corev1.ResourceMemory || name == corev1.ResourceEphemeralStorage {
+			usage[name] = quantity
+		}
+	}
+	for name, quantity := range scheduling.PodLimits(pod) {
+		usage[corev1.ResourceName("limits."+string(name))] = quantity
+	}
+	return usage
+}
+
+func isComputeResource(name corev1.ResourceName) bool {
+	return name == corev1.ResourceCPU || name == corev1.ResourceMemory || name == corev1.ResourceEphemeralStorage ||
+		strings.HasPrefix(string(name), "requests.") || strings.HasPrefix(string(name), "limits.")
+}
+
+// unspecified returns the containers missing the request or limit tracked by a quota, the api server rejects
+// such a pod
+func unspecified(pod *corev1.Pod, name corev1.ResourceName) []string {
+	var tracked corev1.ResourceName
+	limits := false
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU:
+		tracked = corev1.ResourceCPU
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory:
+		tracked = corev1.ResourceMemory
+	case corev1.ResourceLimitsCPU:
+		tracked, limits = corev1.ResourceCPU, true
+	case corev1.ResourceLimitsMemory:
+		tracked, limits = corev1.ResourceMemory, true
+	default:
+		return nil
+	}
+	var missing []string
+	for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		list := container.Resources.Requests
+		if limits {
+			list = container.Resources.Limits
+		}
+		if _, ok := list[tracked]; !ok {
+			missing = append(missing, container.Name)
+		}
+	}
+	return missing
+}
+
+// matchesScopes reports whether the quota counts the pod
+func matchesScopes(pod *corev1.Pod, quota *corev1.ResourceQuota) bool {
+	for _, scope := range quota.Spec.Scopes {
+		if !matchesScope(pod, corev1.ScopedResourceSelectorRequirement{ScopeName: scope, Operator: corev1.ScopeSelectorOpExists}) {
+			return false
+		}
+	}
+	if quota.Spec.ScopeSelector != nil {
+		for _, requirement := range quota.Spec.ScopeSelector.MatchExpressions {
+			if !matchesScope(pod, requirement) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesScope(pod *corev1.Pod, requirement corev1.ScopedResourceSelectorRequirement) bool {
+	switch requirement.ScopeName {
+	case corev1.ResourceQuotaScopeTerminating:
+		return pod.Spec.ActiveDeadlineSeconds != nil
+	case corev1.ResourceQuotaScopeNotTerminating:
+		return pod.Spec.ActiveDeadlineSeconds == nil
+	case corev1.ResourceQuotaScopeBestEffort:
+		return isBestEffort(pod)
+	case corev1.ResourceQuotaScopeNotBestEffort:
+		return !isBestEffort(pod)
+	case corev1.ResourceQuotaScopePriorityClass:
+		switch requirement.Operator {
+		case corev1.ScopeSelectorOpIn:
+			return slices.Contains(requirement.Values, pod.Spec.PriorityClassName)
+		case corev1.ScopeSelectorOpNotIn:
+			return !slices.Contains(requirement.Values, pod.Spec.PriorityClassName)
+		case corev1.ScopeSelectorOpExists:
+			return pod.Spec.PriorityClassName != ""
+		case corev1.ScopeSelectorOpDoesNotExist:
+			return pod.Spec.PriorityClassName == ""
+		}
+	}
+	return false
+}
+
+func isBestEffort(pod *corev1.Pod) bool {
+	for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		if len(container.Resources.Requests) > 0 || len(container.Resources.Limits) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLimitRange checks the containers, and the pod as a whole, against the bounds of the LimitRange. The
+// defaults of the LimitRange have been applied to the pod by the dry-run already.
+func checkLimitRange(pod *corev1.Pod, limitRange *corev1.LimitRange) []string {
+	var reasons []string
+	for _, item := range limitRange.Spec.Limits {
+		switch item.Type {
+		case corev1.LimitTypeContainer:
+			for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+				subject := fmt.Sprintf("container %s", container.Name)
+				reasons = append(reasons, checkBounds(limitRange.Name, subject, item, container.Resources.Requests, container.Resources.Limits)...)
+			}
+		case corev1.LimitTypePod:
+			requests := scheduling.PodRequests(pod)
+			limits := scheduling.PodLimits(pod)
+			reasons = append(reasons, checkBounds(limitRange.Name, "the pod", item, requests, limits)...)
+		}
+	}
+	return reasons
+}
+
+func checkBounds(name, subject string, item corev1.LimitRangeItem, requests, limits corev1.ResourceList) []string {
+	var reasons []string
+	for _, resourceName := range sortedNames(item.Min) {
+		minimum := item.Min[resourceName]
+		if request, ok := requests[resourceName]; ok && request.Cmp(minimum) < 0 {
+			reasons = append(reasons, fmt.Sprintf("the LimitRange %s requires a %s request of at least %s, %s requests %s", name, resourceName, minimum.String(), subject, request.String()))
+		}
+		if limit, ok := limits[resourceName]; ok && limit.Cmp(minimum) < 0 {
+			reasons = append(reasons, fmt.Sprintf("the LimitRange %s requires a %s limit of at least %s, %s is limited to %s", name, resourceName, minimum.String(), subject, limit.String()))
+		}
+	}
+	for _, resourceName := range sortedNames(item.Max) {
+		maximum := item.Max[resourceName]
+		limit, ok := limits[resourceName]
+		switch {
+		case !ok:
+			reasons = append(reasons, fmt.Sprintf("the LimitRange %s requires a %s limit of at most %s, %s has no limit", name, resourceName, maximum.String(), subject))
+		case limit.Cmp(maximum) > 0:
+			reasons = append(reasons, fmt.Sprintf("the LimitRange %s requires a %s limit of at most %s, %s is limited to %s", name, resourceName, maximum.String(), subject, limit.String()))
+		}
+		if request, ok := requests[resourceName]; ok && request.Cmp(maximum) > 0 {
+			reasons = append(reasons, fmt.Sprintf("the LimitRange %s requires a %s request of at most %s, %s requests %s", name, resourceName, maximum.String(), subject, request.String()))
+		}
+	}
+	for _, resourceName := range sortedNames(item.MaxLimitRequestRatio) {
+		ratio := item.MaxLimitRequestRatio[resourceName]
+		request, hasRequest := requests[resourceName]
+		limit, hasLimit := limits[resourceName]
+		if !hasRequest || !hasLimit || request.IsZero() {
+			continue
+		}
+		if actual := float64(limit.MilliValue()) / float64(request.MilliValue()); actual > float64(ratio.MilliValue())/1000 {
+			reasons = append(reasons, fmt.Sprintf("the LimitRange %s allows a %s limit of at most %s times the request, %s has a ratio of %.2f", name, resourceName, ratio.String(), subject, actual))
+		}
+	}
+	return reasons
+}
+
+func sortedNames(list corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func formatList(list corev1.ResourceList) string {
+	var items []string
+	for _, name := range sortedNames(list) {
+		quantity := list[name]
+		items = append(items, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	return strings.Join(items, " ")
+}
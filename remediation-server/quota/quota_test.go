@@ -0,0 +1,100 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod(request, limit string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(request)},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(limit)},
+		}}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func testQuota() corev1.ResourceQuota {
+	return corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourceLimitsMemory: resource.MustParse("2Gi"),
+			corev1.ResourcePods:         resource.MustParse("10"),
+		}},
+		Status: corev1.ResourceQuotaStatus{Used: corev1.ResourceList{
+			corev1.ResourceLimitsMemory: resource.MustParse("1536Mi"),
+			corev1.ResourcePods:         resource.MustParse("3"),
+		}},
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	quotas := []corev1.ResourceQuota{testQuota()}
+	original := testPod("256Mi", "256Mi")
+
+	// the 256Mi of the replaced pod are released
+	assert.NoError(t, Check(testPod("512Mi", "768Mi"), original, quotas, nil))
+
+	err := Check(testPod("512Mi", "1Gi"), original, quotas, nil)
+	var violation *ViolationError
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, []string{"the ResourceQuota compute allows 2Gi of limits.memory and 768Mi is available, the pod needs 1Gi"}, violation.Reasons)
+
+	// a terminated pod does not hold any quota
+	original.Status.Phase = corev1.PodFailed
+	assert.Error(t, Check(testPod("512Mi", "768Mi"), original, quotas, nil))
+
+	pod := testPod("512Mi", "512Mi")
+	pod.Spec.Containers[0].Resources.Limits = nil
+	assert.ErrorContains(t, Check(pod, nil, quotas, nil), "the ResourceQuota compute tracks limits.memory, it must be set on the containers app")
+
+	// a quota scoped to best effort pods does not count pods with resources
+	quotas[0].Spec.Scopes = []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort}
+	assert.NoError(t, Check(testPod("512Mi", "1Gi"), nil, quotas, nil))
+}
+
+func TestCheckLimitRange(t *testing.T) {
+	limitRanges := []corev1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:                 corev1.LimitTypeContainer,
+			Min:                  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			Max:                  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			MaxLimitRequestRatio: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2")},
+		}}},
+	}}
+
+	assert.NoError(t, Check(testPod("256Mi", "512Mi"), nil, nil, limitRanges))
+
+	err := Check(testPod("32Mi", "2Gi"), nil, nil, limitRanges)
+	var violation *ViolationError
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, []string{
+		"the LimitRange limits requires a memory request of at least 64Mi, container app requests 32Mi",
+		"the LimitRange limits requires a memory limit of at most 1Gi, container app is limited to 2Gi",
+		"the LimitRange limits allows a memory limit of at most 2 times the request, container app has a ratio of 64.00",
+	}, violation.Reasons)
+}
+
+func TestDescribe(t *testing.T) {
+	limitRanges := []corev1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:    corev1.LimitTypeContainer,
+			Max:     corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi"), corev1.ResourceCPU: resource.MustParse("2")},
+			Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		}}},
+	}}
+	lines := Describe(testPod("256Mi", "256Mi"), []corev1.ResourceQuota{testQuota()}, limitRanges)
+	assert.Equal(t, []string{
+		"ResourceQuota compute: limits.memory 768Mi available of 2Gi",
+		"LimitRange limits per Container: max cpu=2 memory=1Gi, default limits memory=512Mi",
+	}, lines)
+}
@@ -0,0 +1,200 @@
+package records
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RemediationGVK is the kind of the records that K8sWatchDog keeps for every remediation attempt.
+var RemediationGVK = schema.GroupVersionKind{
+	Group:   "k8swatchdog.io",
+	Version: "v1alpha1",
+	Kind:    "Remediation",
+}
+
+type Phase string
+
+const (
+	PhaseInProgress Phase = "InProgress"
+	PhaseSucceeded  Phase = "Succeeded"
+	PhaseFailed     Phase = "Failed"
+	// PhaseEscalated means that no fix worked, the original object was rolled back and needs a human to look at it
+	PhaseEscalated Phase = "Escalated"
+	// PhaseAwaitingApproval means that the risk of the remediation requires a human to approve it
+	PhaseAwaitingApproval Phase = "AwaitingApproval"
+	// PhaseRefused means that the remediation was too risky or that its approval was rejected or timed out
+	PhaseRefused Phase = "Refused"
+	// PhaseCancelled means that the k8sgpt Result was deleted during the remediation, its problem went away, or that the
+	// remediation was given up while it awaited its approval, ex: the remediation-server stopped
+	PhaseCancelled Phase = "Cancelled"
+)
+
+// ApprovalAnnotation is set on a record AwaitingApproval to approve or reject the remediation
+const ApprovalAnnotation = "k8swatchdog.io/approval"
+
+// Approval values
+const (
+	Approved = "approved"
+	Rejected = "rejected"
+)
+
+// Remediation records a single remediation of a faulty object.
+type Remediation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RemediationSpec   `json:"spec,omitempty"`
+	Status RemediationStatus `json:"status,omitempty"`
+}
+
+type RemediationSpec struct {
+	// Result is the namespace/name of the k8sgpt Result that triggered the remediation
+	Result string `json:"result,omitempty"`
+	// Source identifies the requester of a remediation that was not triggered by a Result, ex: api/<job id>
+	Source string `json:"source,omitempty"`
+	// Kind and Target identify the remediated object, Target is in namespace/name form
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+}
+
+type RemediationStatus struct {
+	Phase Phase `json:"phase,omitempty"`
+	// Backend is the ai backend that produced the applied manifest
+	Backend string `json:"backend,omitempty"`
+	// Explanation, Confidence and ChangedFields are reported by the ai backend along with the manifest
+	Explanation   string   `json:"explanation,omitempty"`
+	Confidence    float64  `json:"confidence,omitempty"`
+	ChangedFields []string `json:"changedFields,omitempty"`
+	// AppliedChanges are the changes of the remediation allowed by the whitelist, PrunedChanges those dropped
+	// from it in prune mode, as path: old -> new
+	AppliedChanges []string `json:"appliedChanges,omitempty"`
+	PrunedChanges  []string `json:"prunedChanges,omitempty"`
+	// RiskScore and RiskReasons weigh the applied changes, Decision is what was done about it
+	RiskScore   float64  `json:"riskScore,omitempty"`
+	RiskReasons []string `json:"riskReasons,omitempty"`
+	Decision    string   `json:"decision,omitempty"`
+	// Sandbox reports the validation of the remediation in the sandbox namespace, ex: why it was skipped
+	Sandbox string `json:"sandbox,omitempty"`
+	// Proposal is the remediation AwaitingApproval, the manifest of the pod or the patches of its workload with their
+	// secrets masked, it is refused if not approved by the ApprovalDeadline
+	Proposal         string       `json:"proposal,omitempty"`
+	ApprovalDeadline *metav1.Time `json:"approvalDeadline,omitempty"`
+	// Attempts and TokensUsed account for the repair turns spent on the Result
+	Attempts   int `json:"attempts,omitempty"`
+	TokensUsed int `json:"tokensUsed,omitempty"`
+	// RedactedValues counts the values masked before the prompt was sent to the ai backend
+	RedactedValues int `json:"redactedValues,omitempty"`
+	// Iterations counts the fixes that were applied and verified
+	Iterations     int          `json:"iterations,omitempty"`
+	Message        string       `json:"message,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// Recorder persists Remediation records in the cluster.
+type Recorder struct {
+	client client.Client
+}
+
+func NewRecorder(c client.Client) *Recorder {
+	return &Recorder{client: c}
+}
+
+// Start creates the record in the InProgress phase, the generated name is written back to rem.
+func (r *Recorder) Start(ctx context.Context, rem *Remediation) error {
+	now := metav1.Now()
+	rem.Status.Phase = PhaseInProgress
+	rem.Status.StartTime = &now
+	obj, err := toUnstructured(rem)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Create(ctx, obj); err != nil {
+		return fmt.Errorf("failed to create remediation record: %v", err)
+	}
+	rem.Name = obj.GetName()
+	rem.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// Finish moves the record to its final phase.
+func (r *Recorder) Finish(ctx context.Context, rem *Remediation, phase Phase, message string) error {
+	now := metav1.Now()
+	rem.Status.Phase = phase
+	rem.Status.Message = message
+	rem.Status.CompletionTime = &now
+	return r.Update(ctx, rem)
+}
+
+// Update writes the current state of the record.
+func (r *Recorder) Update(ctx context.Context, rem *Remediation) error {
+	if rem.Name == "" {
+		return fmt.Errorf("remediation record has not been created")
+	}
+	obj, err := toUnstructured(rem)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Update(ctx, obj); err != nil {
+		return fmt.Errorf("failed to update remediation record %s/%s: %v", rem.Namespace, rem.Name, err)
+	}
+	rem.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// Refresh reads the metadata of the record back from the cluster, ex: to pick up the approval annotation.
+func (r *Recorder) Refresh(ctx context.Context, rem *Remediation) error {
+	if rem.Name == "" {
+		return fmt.Errorf("remediation record has not been created")
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(RemediationGVK)
+	if err := r.client.Get(ctx, client.ObjectKey{Namespace: rem.Namespace, Name: rem.Name}, obj); err != nil {
+		return fmt.Errorf("failed to get remediation record %s/%s: %v", rem.Namespace, rem.Name, err)
+	}
+	rem.Annotations = obj.GetAnnotations()
+	rem.Labels = obj.GetLabels()
+	rem.ResourceVersion = obj.GetResourceVersion()
+	return nil
+}
+
+// LastStarted returns the start time of the latest remediation of the object, zero if it was never remediated. The
+// cancelled remediations are skipped, they were interrupted before their outcome was known.
+func (r *Recorder) LastStarted(ctx context.Context, namespace, kind, target string) (time.Time, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(RemediationGVK.GroupVersion().WithKind(RemediationGVK.Kind + "List"))
+	if err := r.client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return time.Time{}, fmt.Errorf("failed to list the remediation records of %s: %v", namespace, err)
+	}
+	var last time.Time
+	for _, item := range list.Items {
+		var rem Remediation
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &rem); err != nil {
+			continue
+		}
+		if rem.Status.Phase == PhaseCancelled {
+			continue
+		}
+		if rem.Spec.Kind == kind && rem.Spec.Target == target && rem.Status.StartTime != nil && rem.Status.StartTime.After(last) {
+			last = rem.Status.StartTime.Time
+		}
+	}
+	return last, nil
+}
+
+func toUnstructured(rem *Remediation) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(rem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert remediation record to unstructured: %v", err)
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetGroupVersionKind(RemediationGVK)
+	return obj, nil
+}
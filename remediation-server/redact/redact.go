@@ -0,0 +1,235 @@
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// knownSecrets match well known credential formats. If a pattern has a capture group, only the group is masked
+// so that the surrounding context, ex: the name of the variable, stays readable for the model.
+var knownSecrets = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\b`),
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{8,}=*)`),
+	regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?([^\s"',;]{4,})`),
+}
+
+// minEchoLength is the length from which a masked value is also masked wherever it shows up in a text
+const minEchoLength = 8
+
+// candidateToken matches the strings checked for high entropy
+var candidateToken = regexp.MustCompile(`[A-Za-z0-9+/=_.-]{20,}`)
+
+// Config of the redaction pipeline
+type Config struct {
+	// Disabled turns the sessions into no-ops, for ai backends running inside the cluster
+	Disabled bool
+	// AnnotationKeys are the annotations whose values are always masked
+	AnnotationKeys []string
+	// Patterns are custom regexes to mask, with the same capture group semantics as the known formats
+	Patterns []*regexp.Regexp
+	// MinEntropy is the Shannon entropy in bits per character above which a token is considered secret, 0 disables the check
+	MinEntropy float64
+}
+
+// Redactor masks sensitive values before they are sent to an external ai backend.
+type Redactor struct {
+	config Config
+}
+
+func NewRedactor(config Config) *Redactor {
+	return &Redactor{config: config}
+}
+
+// NewSession starts the redaction of a single remediation, the session remembers the masked values so that
+// they can be restored into the manifest returned by the model.
+func (r *Redactor) NewSession() *Session {
+	return &Session{redactor: r, originals: map[string]string{}, placeholders: map[string]string{}}
+}
+
+// Session maps placeholders to the values they replace
+type Session struct {
+	redactor     *Redactor
+	mu           sync.Mutex
+	originals    map[string]string // placeholder -> original value
+	placeholders map[string]string // original value -> placeholder
+}
+
+// Count returns the number of distinct masked values
+func (s *Session) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.originals)
+}
+
+func (s *Session) mask(value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if placeholder, ok := s.placeholders[value]; ok {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("REDACTED_%04d", len(s.originals)+1)
+	s.originals[placeholder] = value
+	s.placeholders[value] = placeholder
+	return placeholder
+}
+
+// RedactPod returns a copy of the pod with the inline env values and the configured annotations masked.
+// Values referenced through secretKeyRef or configMapKeyRef never leave the cluster in the first place.
+func (s *Session) RedactPod(pod *corev1.Pod) *corev1.Pod {
+	pod = pod.DeepCopy()
+	if s.redactor.config.Disabled {
+		return pod
+	}
+	for _, key := range s.redactor.config.AnnotationKeys {
+		if value, ok := pod.Annotations[key]; ok && value != "" {
+			pod.Annotations[key] = s.mask(value)
+		}
+	}
+	redactEnv := func(containers []corev1.Container) {
+		for i := range containers {
+			for j := range containers[i].Env {
+				if env := &containers[i].Env[j]; env.Value != "" {
+					env.Value = s.mask(env.Value)
+				}
+			}
+		}
+	}
+	redactEnv(pod.Spec.InitContainers)
+	redactEnv(pod.Spec.Containers)
+	for i := range pod.Spec.EphemeralContainers {
+		for j := range pod.Spec.EphemeralContainers[i].Env {
+			if env := &pod.Spec.EphemeralContainers[i].Env[j]; env.Value != "" {
+				env.Value = s.mask(env.Value)
+			}
+		}
+	}
+	return pod
+}
+
+// RedactText masks the values of the text that look like secrets, ex: the prompt with the logs of the pod
+func (s *Session) RedactText(text string) string {
+	if s.redactor.config.Disabled {
+		return text
+	}
+	// values masked earlier in the session, ex: env values echoed back in a dry-run error, stay masked. Short
+	// values like "true" or "8080" would match all over the text, they are only masked where they are set.
+	s.mu.Lock()
+	for original, placeholder := range s.placeholders {
+		if len(original) >= minEchoLength {
+			text = strings.ReplaceAll(text, original, placeholder)
+		}
+	}
+	s.mu.Unlock()
+	patterns := append(append([]*regexp.Regexp{}, knownSecrets...), s.redactor.config.Patterns...)
+	for _, pattern := range patterns {
+		text = s.replacePattern(pattern, text)
+	}
+	if s.redactor.config.MinEntropy > 0 {
+		text = candidateToken.ReplaceAllStringFunc(text, func(token string) string {
+			if strings.HasPrefix(token, "REDACTED_") || !isSecretLike(token, s.redactor.config.MinEntropy) {
+				return token
+			}
+			return s.mask(token)
+		})
+	}
+	return text
+}
+
+func (s *Session) replacePattern(pattern *regexp.Regexp, text string) string {
+	if pattern.NumSubexp() == 0 {
+		return pattern.ReplaceAllStringFunc(text, s.mask)
+	}
+	var out strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		if loc[2] < 0 {
+			continue
+		}
+		out.WriteString(text[last:loc[2]])
+		out.WriteString(s.mask(text[loc[2]:loc[3]]))
+		last = loc[3]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// Restore puts the original values back into the manifest returned by the model. The manifest is decoded and
+// the placeholders are replaced in its string values, so values with YAML special characters stay valid.
+func (s *Session) Restore(manifest string) (string, error) {
+	if s.Count() == 0 || !strings.Contains(manifest, "REDACTED_") {
+		return manifest, nil
+	}
+	var obj interface{}
+	if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+		return "", fmt.Errorf("failed to decode the manifest to restore the redacted values: %v", err)
+	}
+	obj = s.restore(obj)
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the restored manifest: %v", err)
+	}
+	return string(out), nil
+}
+
+func (s *Session) restore(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = s.restore(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = s.restore(item)
+		}
+	case string:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for placeholder, original := range s.originals {
+			v = strings.ReplaceAll(v, placeholder, original)
+		}
+		return v
+	}
+	return value
+}
+
+// isSecretLike reports whether the token has a high entropy and mixes letters and digits, which rules out
+// most words, paths and hex digests
+func isSecretLike(token string, minEntropy float64) bool {
+	var letters, digits bool
+	for _, r := range token {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			letters = true
+		}
+	}
+	return letters && digits && entropy(token) >= minEntropy
+}
+
+// entropy returns the Shannon entropy of the string in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
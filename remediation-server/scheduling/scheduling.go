@@ -0,0 +1,503 @@
+// Package scheduling simulates whether a pod fits on the nodes of the cluster, so that the remediation of a
+// Pending pod which would stay Pending is rejected before it is applied. The node selector, the required node
+// affinity, the taints, the allocatable resources, the required pod affinity and anti-affinity and the topology
+// spread constraints of the pod are checked against a snapshot of the cluster. Preemption is not simulated, a
+// pod which only fits by evicting pods of a lower priority is reported as not fitting.
+package scheduling
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// Snapshot is the state of the cluster the pod is scheduled against
+type Snapshot struct {
+	Nodes []corev1.Node
+	// Pods are the pods of the cluster, the ones not bound to a node or terminated are ignored
+	Pods []corev1.Pod
+	// Namespaces are used to resolve the namespace selectors of the pod affinity terms
+	Namespaces []corev1.Namespace
+}
+
+// InfeasibleError is returned by Check when none of the nodes can run the pod
+type InfeasibleError struct {
+	Nodes int
+	// Reasons are the constraints that failed prefixed by the number of nodes they failed on, the most common first
+	Reasons []string
+}
+
+func (e *InfeasibleError) Error() string {
+	if e.Nodes == 0 {
+		return "the cluster has no nodes"
+	}
+	return fmt.Sprintf("0/%d nodes can run the pod: %s", e.Nodes, strings.Join(e.Reasons, "; "))
+}
+
+// Check returns an *InfeasibleError listing the constraints that failed if the pod fits on none of the nodes
+func Check(pod *corev1.Pod, snapshot Snapshot) error {
+	s := newScheduler(pod, snapshot)
+	failures := map[string]int{}
+	for i := range snapshot.Nodes {
+		reasons := s.filter(&snapshot.Nodes[i])
+		if len(reasons) == 0 {
+			return nil
+		}
+		for _, reason := range reasons {
+			failures[reason]++
+		}
+	}
+
+	reasons := make([]string, 0, len(failures))
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if failures[reasons[i]] != failures[reasons[j]] {
+			return failures[reasons[i]] > failures[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	for i, reason := range reasons {
+		count := failures[reason]
+		if free, ok := s.largestFree[reason]; ok {
+			requested := s.requests[s.insufficient[reason]]
+			reason = fmt.Sprintf("%s (the pod requests %s, at most %s is free on a node)", reason, requested.String(), free.String())
+		}
+		reasons[i] = fmt.Sprintf("%d %s", count, reason)
+	}
+	return &InfeasibleError{Nodes: len(snapshot.Nodes), Reasons: reasons}
+}
+
+type scheduler struct {
+	pod      *corev1.Pod
+	snapshot Snapshot
+	requests corev1.ResourceList
+	// podsOn are the running pods per node name
+	podsOn map[string][]*corev1.Pod
+	nodes  map[string]*corev1.Node
+	// largestFree is the largest amount of a resource free on the nodes it is insufficient on, by failure reason
+	largestFree  map[string]resource.Quantity
+	insufficient map[string]corev1.ResourceName
+}
+
+func newScheduler(pod *corev1.Pod, snapshot Snapshot) *scheduler {
+	s := &scheduler{
+		pod:          pod,
+		snapshot:     snapshot,
+		requests:     PodRequests(pod),
+		podsOn:       map[string][]*corev1.Pod{},
+		nodes:        map[string]*corev1.Node{},
+		largestFree:  map[string]resource.Quantity{},
+		insufficient: map[string]corev1.ResourceName{},
+	}
+	for i := range snapshot.Nodes {
+		s.nodes[snapshot.Nodes[i].Name] = &snapshot.Nodes[i]
+	}
+	for i := range snapshot.Pods {
+		existing := &snapshot.Pods[i]
+		if existing.Spec.NodeName == "" || existing.Status.Phase == corev1.PodSucceeded || existing.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		// the pod is replaced by the remediated one
+		if existing.Namespace == pod.Namespace && existing.Name == pod.Name {
+			continue
+		}
+		s.podsOn[existing.Spec.NodeName] = append(s.podsOn[existing.Spec.NodeName], existing)
+	}
+	return s
+}
+
+// filter returns the reasons the pod does not fit on the node
+func (s *scheduler) filter(node *corev1.Node) []string {
+	var reasons []string
+	if !matchesNodeSelector(s.pod, node) {
+		reasons = append(reasons, fmt.Sprintf("did not match the node selector {%s}", labels.FormatLabels(s.pod.Spec.NodeSelector)))
+	}
+	if !matchesNodeAffinity(s.pod, node) {
+		reasons = append(reasons, "did not match the required node affinity")
+	}
+	if taint := untoleratedTaint(s.pod, node); taint != nil {
+		reasons = append(reasons, fmt.Sprintf("had the untolerated taint {%s}", taint.ToString()))
+	}
+	reasons = append(reasons, s.fitResources(node)...)
+	reasons = append(reasons, s.checkPodAffinity(node)...)
+	reasons = append(reasons, s.checkTopologySpread(node)...)
+	return reasons
+}
+
+func matchesNodeSelector(pod *corev1.Pod, node *corev1.Node) bool {
+	for key, value := range pod.Spec.NodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesNodeAffinity(pod *corev1.Pod, node *corev1.Node) bool {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil || pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	// the terms are ORed, the requirements of a term are ANDed
+	for _, term := range pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		matches := true
+		for _, requirement := range term.MatchExpressions {
+			matches = matches && matchesRequirement(requirement, node.Labels)
+		}
+		for _, requirement := range term.MatchFields {
+			matches = matches && requirement.Key == "metadata.name" && matchesRequirement(requirement, map[string]string{"metadata.name": node.Name})
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesRequirement(requirement corev1.NodeSelectorRequirement, nodeLabels map[string]string) bool {
+	value, ok := nodeLabels[requirement.Key]
+	switch requirement.Operator {
+	case corev1.NodeSelectorOpIn:
+		return ok && slices.Contains(requirement.Values, value)
+	case corev1.NodeSelectorOpNotIn:
+		return !ok || !slices.Contains(requirement.Values, value)
+	case corev1.NodeSelectorOpExists:
+		return ok
+	case corev1.NodeSelectorOpDoesNotExist:
+		return !ok
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		if !ok || len(requirement.Values) != 1 {
+			return false
+		}
+		actual, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		bound, err := strconv.ParseInt(requirement.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if requirement.Operator == corev1.NodeSelectorOpGt {
+			return actual > bound
+		}
+		return actual < bound
+	}
+	return false
+}
+
+// untoleratedTaint returns the first NoSchedule or NoExecute taint of the node the pod does not tolerate, a
+// cordoned node is treated as tainted like the scheduler does
+func untoleratedTaint(pod *corev1.Pod, node *corev1.Node) *corev1.Taint {
+	taints := node.Spec.Taints
+	if node.Spec.Unschedulable {
+		taints = append([]corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}, taints...)
+	}
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !tolerates(pod.Spec.Tolerations, taint) {
+			return taint
+		}
+	}
+	return nil
+}
+
+func tolerates(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for _, toleration := range tolerations {
+		if toleration.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// fitResources checks the requests of the pod against the allocatable resources of the node minus the requests of
+// the pods running on it
+func (s *scheduler) fitResources(node *corev1.Node) []string {
+	var reasons []string
+	if allocatable, ok := node.Status.Allocatable[corev1.ResourcePods]; ok && int64(len(s.podsOn[node.Name])) >= allocatable.Value() {
+		reasons = append(reasons, "had too many pods")
+	}
+
+	used := corev1.ResourceList{}
+	for _, existing := range s.podsOn[node.Name] {
+		addResources(used, PodRequests(existing))
+	}
+	names := make([]string, 0, len(s.requests))
+	for name := range s.requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		requested := s.requests[corev1.ResourceName(name)]
+		if requested.IsZero() {
+			continue
+		}
+		free := node.Status.Allocatable[corev1.ResourceName(name)].DeepCopy()
+		free.Sub(used[corev1.ResourceName(name)])
+		if free.Cmp(requested) >= 0 {
+			continue
+		}
+		reason := "had insufficient " + name
+		reasons = append(reasons, reason)
+		s.insufficient[reason] = corev1.ResourceName(name)
+		if largest, ok := s.largestFree[reason]; !ok || free.Cmp(largest) > 0 {
+			s.largestFree[reason] = free
+		}
+	}
+	return reasons
+}
+
+// PodRequests returns the resources the scheduler reserves for the pod: the requests of its containers and
+// sidecars, or of its largest init container if higher, plus the pod overhead
+func PodRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := podResources(pod, func(resources corev1.ResourceRequirements) corev1.ResourceList { return resources.Requests })
+	addResources(requests, pod.Spec.Overhead)
+	return requests
+}
+
+// PodLimits returns the limits of the pod, summed up the same way as the requests. The overhead only counts for
+// the resources that are limited.
+func PodLimits(pod *corev1.Pod) corev1.ResourceList {
+	limits := podResources(pod, func(resources corev1.ResourceRequirements) corev1.ResourceList { return resources.Limits })
+	for name, quantity := range pod.Spec.Overhead {
+		if _, ok := limits[name]; ok {
+			addResources(limits, corev1.ResourceList{name: quantity})
+		}
+	}
+	return limits
+}
+
+func podResources(pod *corev1.Pod, of func(corev1.ResourceRequirements) corev1.ResourceList) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(total, of(container.Resources))
+	}
+	sidecars := corev1.ResourceList{}
+	initResources := corev1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			// a sidecar keeps running along with the containers
+			addResources(total, of(container.Resources))
+			addResources(sidecars, of(container.Resources))
+			continue
+		}
+		// an init container runs along with the sidecars started before it
+		running := sidecars.DeepCopy()
+		addResources(running, of(container.Resources))
+		maxResources(initResources, running)
+	}
+	maxResources(total, initResources)
+	return total
+}
+
+func addResources(total, add corev1.ResourceList) {
+	for name, quantity := range add {
+		sum := total[name].DeepCopy()
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+func maxResources(total, other corev1.ResourceList) {
+	for name, quantity := range other {
+		if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// checkPodAffinity checks the required pod affinity and anti-affinity terms of the pod, and the required
+// anti-affinity terms of the pods already running, for the topology domain of the node
+func (s *scheduler) checkPodAffinity(node *corev1.Node) []string {
+	var reasons []string
+	if affinity := s.pod.Spec.Affinity; affinity != nil && affinity.PodAffinity != nil {
+		for _, term := range affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			if s.countInDomain(s.pod, term, node) > 0 {
+				continue
+			}
+			// the first pod of a group matching its own affinity can go anywhere
+			if s.countInDomain(s.pod, term, nil) == 0 && s.matchesTerm(s.pod, s.pod, term) {
+				continue
+			}
+			reasons = append(reasons, fmt.Sprintf("did not satisfy the pod affinity %s", describeTerm(term)))
+		}
+	}
+	if affinity := s.pod.Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+		for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			if s.countInDomain(s.pod, term, node) > 0 {
+				reasons = append(reasons, fmt.Sprintf("conflicted with the pod anti-affinity %s", describeTerm(term)))
+			}
+		}
+	}
+	for _, pods := range s.podsOn {
+		for _, existing := range pods {
+			if existing.Spec.Affinity == nil || existing.Spec.Affinity.PodAntiAffinity == nil {
+				continue
+			}
+			for _, term := range existing.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if s.sameDomain(node, existing.Spec.NodeName, term.TopologyKey) && s.matchesTerm(existing, s.pod, term) {
+					reasons = append(reasons, fmt.Sprintf("conflicted with the pod anti-affinity of the pod %s/%s", existing.Namespace, existing.Name))
+				}
+			}
+		}
+	}
+	return reasons
+}
+
+// countInDomain counts the pods matching the term of the owner in the topology domain of the node, or in the
+// whole cluster if the node is nil
+func (s *scheduler) countInDomain(owner *corev1.Pod, term corev1.PodAffinityTerm, node *corev1.Node) int {
+	count := 0
+	for nodeName, pods := range s.podsOn {
+		if node != nil && !s.sameDomain(node, nodeName, term.TopologyKey) {
+			continue
+		}
+		for _, existing := range pods {
+			if s.matchesTerm(owner, existing, term) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// sameDomain reports whether the node and the node with the given name share the value of the topology key
+func (s *scheduler) sameDomain(node *corev1.Node, nodeName, topologyKey string) bool {
+	other, ok := s.nodes[nodeName]
+	if !ok {
+		return false
+	}
+	value, ok := node.Labels[topologyKey]
+	return ok && other.Labels[topologyKey] == value
+}
+
+// matchesTerm reports whether the pod is selected by the affinity term of the owner
+func (s *scheduler) matchesTerm(owner, pod *corev1.Pod, term corev1.PodAffinityTerm) bool {
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil || term.LabelSelector == nil || !selector.Matches(labels.Set(pod.Labels)) {
+		return false
+	}
+	if slices.Contains(term.Namespaces, pod.Namespace) {
+		return true
+	}
+	if term.NamespaceSelector != nil {
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(term.NamespaceSelector)
+		if err != nil {
+			return false
+		}
+		for _, namespace := range s.snapshot.Namespaces {
+			if namespace.Name == pod.Namespace {
+				return namespaceSelector.Matches(labels.Set(namespace.Labels))
+			}
+		}
+		return namespaceSelector.Empty()
+	}
+	return len(term.Namespaces) == 0 && pod.Namespace == owner.Namespace
+}
+
+func describeTerm(term corev1.PodAffinityTerm) string {
+	return fmt.Sprintf("{topologyKey: %s, selector: %s}", term.TopologyKey, metav1.FormatLabelSelector(term.LabelSelector))
+}
+
+// checkTopologySpread checks the DoNotSchedule topology spread constraints of the pod: placing the pod on the node
+// must not make its domain exceed the domain with the fewest matching pods by more than maxSkew
+func (s *scheduler) checkTopologySpread(node *corev1.Node) []string {
+	var reasons []string
+	for _, constraint := range s.pod.Spec.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+		value, ok := node.Labels[constraint.TopologyKey]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("did not have the topology spread key %s", constraint.TopologyKey))
+			continue
+		}
+		selector, err := spreadSelector(s.pod, constraint)
+		if err != nil {
+			continue
+		}
+
+		counts := map[string]int{}
+		for i := range s.snapshot.Nodes {
+			candidate := &s.snapshot.Nodes[i]
+			domain, ok := candidate.Labels[constraint.TopologyKey]
+			if !ok || !s.countsForSpread(candidate, constraint) {
+				continue
+			}
+			if _, ok := counts[domain]; !ok {
+				counts[domain] = 0
+			}
+			for _, existing := range s.podsOn[candidate.Name] {
+				if existing.Namespace == s.pod.Namespace && selector.Matches(labels.Set(existing.Labels)) {
+					counts[domain]++
+				}
+			}
+		}
+		minimum := -1
+		for _, count := range counts {
+			if minimum < 0 || count < minimum {
+				minimum = count
+			}
+		}
+		if minimum < 0 || (constraint.MinDomains != nil && int32(len(counts)) < *constraint.MinDomains) {
+			minimum = 0
+		}
+		self := 0
+		if selector.Matches(labels.Set(s.pod.Labels)) {
+			self = 1
+		}
+		if skew := counts[value] + self - minimum; skew > int(constraint.MaxSkew) {
+			reasons = append(reasons, fmt.Sprintf("would exceed the maxSkew %d of the topology spread on %s with a skew of %d", constraint.MaxSkew, constraint.TopologyKey, skew))
+		}
+	}
+	return reasons
+}
+
+// countsForSpread reports whether the pods of the node count towards the spread, following the node affinity and
+// node taints policies of the constraint
+func (s *scheduler) countsForSpread(node *corev1.Node, constraint corev1.TopologySpreadConstraint) bool {
+	if constraint.NodeAffinityPolicy == nil || *constraint.NodeAffinityPolicy == corev1.NodeInclusionPolicyHonor {
+		if !matchesNodeSelector(s.pod, node) || !matchesNodeAffinity(s.pod, node) {
+			return false
+		}
+	}
+	if constraint.NodeTaintsPolicy != nil && *constraint.NodeTaintsPolicy == corev1.NodeInclusionPolicyHonor {
+		return untoleratedTaint(s.pod, node) == nil
+	}
+	return true
+}
+
+// spreadSelector returns the label selector of the constraint with the matchLabelKeys set to the labels of the pod
+func spreadSelector(pod *corev1.Pod, constraint corev1.TopologySpreadConstraint) (labels.Selector, error) {
+	selector, err := metav1.LabelSelectorAsSelector(constraint.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range constraint.MatchLabelKeys {
+		value, ok := pod.Labels[key]
+		if !ok {
+			continue
+		}
+		requirement, err := labels.NewRequirement(key, selection.Equals, []string{value})
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*requirement)
+	}
+	return selector, nil
+}
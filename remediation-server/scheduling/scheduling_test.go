@@ -0,0 +1,170 @@
+package scheduling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name, zone, cpu, memory string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			"kubernetes.io/hostname":      name,
+			"topology.kubernetes.io/zone": zone,
+		}},
+		Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+			corev1.ResourcePods:   resource.MustParse("110"),
+		}},
+	}
+}
+
+func testPod(name, node, cpu, memory string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Containers: []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			}}}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestCheckResources(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: []corev1.Node{testNode("node-a", "a", "2", "4Gi"), testNode("node-b", "b", "4", "2Gi")},
+		Pods:  []corev1.Pod{testPod("busy", "node-a", "1", "1Gi")},
+	}
+
+	pod := testPod("web", "", "2", "1Gi")
+	assert.NoError(t, Check(&pod, snapshot), "node-b has room for the pod")
+
+	pod = testPod("web", "", "2", "3Gi")
+	err := Check(&pod, snapshot)
+	var infeasible *InfeasibleError
+	require.ErrorAs(t, err, &infeasible)
+	assert.Equal(t, 2, infeasible.Nodes)
+	assert.Equal(t, []string{
+		"1 had insufficient cpu (the pod requests 2, at most 1 is free on a node)",
+		"1 had insufficient memory (the pod requests 3Gi, at most 2Gi is free on a node)",
+	}, infeasible.Reasons)
+	assert.ErrorContains(t, err, "0/2 nodes can run the pod")
+
+	// the pod being replaced does not hold its resources
+	pod = testPod("busy", "", "2", "3Gi")
+	assert.NoError(t, Check(&pod, snapshot))
+}
+
+func TestCheckNodeConstraints(t *testing.T) {
+	tainted := testNode("node-a", "a", "4", "4Gi")
+	tainted.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	cordoned := testNode("node-b", "b", "4", "4Gi")
+	cordoned.Spec.Unschedulable = true
+	cordoned.Labels["disktype"] = "ssd"
+	snapshot := Snapshot{Nodes: []corev1.Node{tainted, cordoned}}
+
+	pod := testPod("web", "", "1", "1Gi")
+	pod.Spec.NodeSelector = map[string]string{"disktype": "ssd"}
+	err := Check(&pod, snapshot)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 did not match the node selector {disktype=ssd}")
+	assert.Contains(t, err.Error(), "1 had the untolerated taint {dedicated=gpu:NoSchedule}")
+	assert.Contains(t, err.Error(), "1 had the untolerated taint {node.kubernetes.io/unschedulable:NoSchedule}")
+
+	pod.Spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	pod.Spec.NodeSelector = nil
+	pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+		NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+		}}},
+	}}}
+	assert.NoError(t, Check(&pod, snapshot), "the toleration and the affinity select node-a")
+
+	pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values = []string{"c"}
+	assert.ErrorContains(t, Check(&pod, snapshot), "2 did not match the required node affinity")
+
+	assert.EqualError(t, Check(&pod, Snapshot{}), "the cluster has no nodes")
+}
+
+func TestCheckPodAffinity(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: []corev1.Node{testNode("node-a", "a", "4", "4Gi"), testNode("node-b", "b", "4", "4Gi")},
+		Pods:  []corev1.Pod{testPod("web-1", "node-a", "1", "1Gi"), testPod("web-2", "node-b", "1", "1Gi")},
+	}
+	term := corev1.PodAffinityTerm{
+		TopologyKey:   "kubernetes.io/hostname",
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	}
+
+	pod := testPod("web-3", "", "1", "1Gi")
+	pod.Spec.Affinity = &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term}}}
+	assert.ErrorContains(t, Check(&pod, snapshot), "2 conflicted with the pod anti-affinity {topologyKey: kubernetes.io/hostname, selector: app=web}")
+
+	pod.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term}}}
+	assert.NoError(t, Check(&pod, snapshot))
+
+	// the first pod of a group matching its own affinity can go anywhere
+	assert.NoError(t, Check(&pod, Snapshot{Nodes: snapshot.Nodes}))
+
+	term.LabelSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+	pod.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term}}}
+	assert.ErrorContains(t, Check(&pod, snapshot), "2 did not satisfy the pod affinity")
+
+	// the anti-affinity of the running pods applies to the new pod as well
+	running := snapshot.Pods[0]
+	running.Spec.Affinity = &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+		TopologyKey:   "kubernetes.io/hostname",
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	}}}}
+	pod.Spec.Affinity = nil
+	err := Check(&pod, Snapshot{Nodes: snapshot.Nodes[:1], Pods: []corev1.Pod{running}})
+	assert.ErrorContains(t, err, "1 conflicted with the pod anti-affinity of the pod default/web-1")
+}
+
+func TestCheckTopologySpread(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: []corev1.Node{testNode("node-a", "a", "4", "4Gi"), testNode("node-b", "b", "1", "1Gi")},
+		Pods:  []corev1.Pod{testPod("web-1", "node-a", "1", "1Gi"), testPod("web-2", "node-b", "1", "1Gi")},
+	}
+	pod := testPod("web-3", "", "1", "1Gi")
+	pod.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       "topology.kubernetes.io/zone",
+		WhenUnsatisfiable: corev1.DoNotSchedule,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	}}
+	// zone a has room and the skew is 1
+	assert.NoError(t, Check(&pod, snapshot))
+
+	snapshot.Pods = append(snapshot.Pods, testPod("web-0", "node-a", "100m", "100Mi"))
+	err := Check(&pod, snapshot)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 would exceed the maxSkew 1 of the topology spread on topology.kubernetes.io/zone with a skew of 2")
+	assert.Contains(t, err.Error(), "1 had insufficient cpu")
+
+	pod.Spec.TopologySpreadConstraints[0].WhenUnsatisfiable = corev1.ScheduleAnyway
+	assert.NoError(t, Check(&pod, snapshot), "the spread is only preferred")
+}
+
+func TestPodRequests(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	pod := testPod("web", "", "500m", "256Mi")
+	pod.Spec.InitContainers = []corev1.Container{
+		{Name: "sidecar", RestartPolicy: &always, Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}},
+		{Name: "migrate", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}},
+	}
+	pod.Spec.Overhead = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")}
+
+	requests := PodRequests(&pod)
+	cpu, memory := requests[corev1.ResourceCPU], requests[corev1.ResourceMemory]
+	assert.Equal(t, "1100m", cpu.String(), "the init container runs along with the sidecar")
+	assert.Equal(t, "320Mi", memory.String())
+}
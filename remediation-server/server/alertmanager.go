@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+)
+
+// alertStatusResolved is the status of the alerts that stopped firing
+const alertStatusResolved = "resolved"
+
+// alertTargets are the labels naming the object of an alert and its kind, the first one set is used
+var alertTargets = []struct {
+	label string
+	kind  string
+}{
+	{"pod", "Pod"},
+	{"deployment", "Deployment"},
+	{"statefulset", "StatefulSet"},
+	{"daemonset", "DaemonSet"},
+}
+
+// WebhookMessage is the payload Alertmanager posts to its webhook receivers
+type WebhookMessage struct {
+	Version  string         `json:"version"`
+	GroupKey string         `json:"groupKey"`
+	Status   string         `json:"status"`
+	Receiver string         `json:"receiver"`
+	Alerts   []WebhookAlert `json:"alerts"`
+}
+
+// WebhookAlert is a single alert of a WebhookMessage
+type WebhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// AlertOutcome tells what was done about an alert of a WebhookMessage
+type AlertOutcome struct {
+	Fingerprint string `json:"fingerprint"`
+	// Job is the job remediating the object of the alert, empty if the alert was skipped for the Reason
+	Job    string `json:"job,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// receiveAlerts starts a job for every firing alert naming an object. An alert is only acted on once until it
+// resolves, as Alertmanager resends the firing alerts at every repeat interval.
+func (s *Server) receiveAlerts(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var message WebhookMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&message); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse the alerts: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	outcomes := make([]AlertOutcome, 0, len(message.Alerts))
+	for _, alert := range message.Alerts {
+		outcome := s.receiveAlert(ctx, alert)
+		if outcome.Reason != "" {
+			s.logger.Info("alert skipped", zap.String("fingerprint", outcome.Fingerprint), zap.String("alertname", alert.Labels["alertname"]),
+				zap.String("reason", outcome.Reason))
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	writeJSON(w, http.StatusOK, outcomes)
+}
+
+func (s *Server) receiveAlert(ctx context.Context, alert WebhookAlert) AlertOutcome {
+	fingerprint := alert.Fingerprint
+	if fingerprint == "" {
+		fingerprint = labelsFingerprint(alert.Labels)
+	}
+	outcome := AlertOutcome{Fingerprint: fingerprint}
+
+	if alert.Status == alertStatusResolved {
+		// the alert can trigger a remediation again if it fires anew
+		s.mu.Lock()
+		delete(s.alerts, fingerprint)
+		s.mu.Unlock()
+		outcome.Reason = "the alert is resolved"
+		return outcome
+	}
+	request, err := alertRequest(alert)
+	if err != nil {
+		outcome.Reason = err.Error()
+		return outcome
+	}
+
+	// the alert is remembered until it resolves, every notification pushes its expiry back in case the resolved
+	// notification is lost
+	expires := time.Now().Add(alertRetention)
+	if alert.EndsAt.After(expires) {
+		expires = alert.EndsAt
+	}
+	s.mu.Lock()
+	_, seen := s.alerts[fingerprint]
+	s.alerts[fingerprint] = expires
+	s.mu.Unlock()
+	if seen {
+		outcome.Reason = "the alert has already triggered a remediation"
+		return outcome
+	}
+
+	job, started := s.start(ctx, request)
+	outcome.Job = job.ID
+	if !started {
+		// the alert triggers a remediation on its next notification, once the running one is done
+		s.mu.Lock()
+		delete(s.alerts, fingerprint)
+		s.mu.Unlock()
+		outcome.Reason = "the object is already being remediated"
+	}
+	return outcome
+}
+
+// alertRequest maps the labels of the alert to the object to remediate, the annotations describe the problem
+func alertRequest(alert WebhookAlert) (types.ObjectRequest, error) {
+	request := types.ObjectRequest{Namespace: alert.Labels["namespace"]}
+	for _, target := range alertTargets {
+		if name := alert.Labels[target.label]; name != "" {
+			request.Kind, request.Name = target.kind, name
+			break
+		}
+	}
+	if request.Namespace == "" || request.Name == "" {
+		return request, fmt.Errorf("the alert has no namespace label, or none of the pod, deployment, statefulset and daemonset labels")
+	}
+
+	var problem strings.Builder
+	fmt.Fprintf(&problem, "The Prometheus alert %s is firing", alert.Labels["alertname"])
+	if !alert.StartsAt.IsZero() {
+		fmt.Fprintf(&problem, " since %s", alert.StartsAt.UTC().Format(time.RFC3339))
+	}
+	problem.WriteString(".\n")
+	if container := alert.Labels["container"]; container != "" {
+		fmt.Fprintf(&problem, "It is about the container %s.\n", container)
+	}
+	// the summary and description come first, the other annotations follow in order
+	keys := make([]string, 0, len(alert.Annotations))
+	for key := range alert.Annotations {
+		if key != "summary" && key != "description" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range append([]string{"summary", "description"}, keys...) {
+		if value := alert.Annotations[key]; value != "" {
+			fmt.Fprintf(&problem, "%s: %s\n", key, value)
+		}
+	}
+	request.Problem = strings.TrimSpace(problem.String())
+	return request, nil
+}
+
+// labelsFingerprint identifies an alert sent without a fingerprint by its labels
+func labelsFingerprint(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\x00", key, labels[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
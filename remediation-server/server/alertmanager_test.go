@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const firing = `{
+	"version": "4",
+	"status": "firing",
+	"alerts": [
+		{
+			"status": "firing",
+			"labels": {"alertname": "KubePodCrashLooping", "namespace": "shop", "pod": "web-5d9c7", "container": "app"},
+			"annotations": {"description": "Pod shop/web-5d9c7 is restarting 2 times / 10 minutes.", "runbook_url": "https://runbooks/crashloop", "summary": "Pod is crash looping."},
+			"startsAt": "2025-03-01T10:00:00Z",
+			"fingerprint": "a1"
+		},
+		{
+			"status": "firing",
+			"labels": {"alertname": "KubeDeploymentReplicasMismatch", "namespace": "shop", "deployment": "api"},
+			"annotations": {"summary": "Deployment has not matched the expected number of replicas."},
+			"fingerprint": "b2"
+		},
+		{
+			"status": "firing",
+			"labels": {"alertname": "NodeFilesystemAlmostFull", "instance": "node-1"},
+			"fingerprint": "c3"
+		}
+	]
+}`
+
+func postAlerts(t *testing.T, handler http.Handler, body string) []AlertOutcome {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/alertmanager", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var outcomes []AlertOutcome
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &outcomes))
+	return outcomes
+}
+
+func TestReceiveAlerts(t *testing.T) {
+	var mu sync.Mutex
+	var got []types.ObjectRequest
+	remediate := func(ctx context.Context, request types.ObjectRequest, source string, started func(string)) (*records.Remediation, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, request)
+		return nil, nil
+	}
+	s := New(remediate, "secret", zap.NewNop())
+	handler := s.Handler(context.Background())
+
+	outcomes := postAlerts(t, handler, firing)
+	require.Len(t, outcomes, 3)
+	assert.NotEmpty(t, outcomes[0].Job)
+	assert.Empty(t, outcomes[0].Reason)
+	assert.NotEmpty(t, outcomes[1].Job)
+	assert.Contains(t, outcomes[2].Reason, "has no namespace label")
+	s.Wait()
+
+	require.Len(t, got, 2)
+	pod, deployment := got[0], got[1]
+	if pod.Kind != "Pod" {
+		pod, deployment = deployment, pod
+	}
+	assert.Equal(t, "shop", pod.Namespace)
+	assert.Equal(t, "web-5d9c7", pod.Name)
+	assert.Equal(t, "The Prometheus alert KubePodCrashLooping is firing since 2025-03-01T10:00:00Z.\n"+
+		"It is about the container app.\n"+
+		"summary: Pod is crash looping.\n"+
+		"description: Pod shop/web-5d9c7 is restarting 2 times / 10 minutes.\n"+
+		"runbook_url: https://runbooks/crashloop", pod.Problem)
+	assert.Equal(t, types.ObjectRequest{Kind: "Deployment", Namespace: "shop", Name: "api",
+		Problem: "The Prometheus alert KubeDeploymentReplicasMismatch is firing.\nsummary: Deployment has not matched the expected number of replicas."}, deployment)
+
+	// the repeated notifications of a firing alert are ignored
+	outcomes = postAlerts(t, handler, firing)
+	assert.Equal(t, "the alert has already triggered a remediation", outcomes[0].Reason)
+	assert.Empty(t, outcomes[0].Job)
+
+	// once resolved the alert can trigger a remediation again
+	outcomes = postAlerts(t, handler, strings.ReplaceAll(firing, `"status": "firing"`, `"status": "resolved"`))
+	assert.Equal(t, "the alert is resolved", outcomes[0].Reason)
+	outcomes = postAlerts(t, handler, firing)
+	assert.NotEmpty(t, outcomes[0].Job)
+	s.Wait()
+	assert.Len(t, got, 4)
+
+	// the firing alerts are remembered past the retention of the jobs, and forgotten once they are not notified anymore
+	s.mu.Lock()
+	s.prune(time.Now().Add(2 * jobRetention))
+	assert.Len(t, s.alerts, 2)
+	s.prune(time.Now().Add(2 * alertRetention))
+	assert.Empty(t, s.alerts)
+	s.mu.Unlock()
+}
+
+func TestReceiveAlertOfBusyObject(t *testing.T) {
+	release := make(chan struct{})
+	remediate := func(ctx context.Context, request types.ObjectRequest, source string, started func(string)) (*records.Remediation, error) {
+		<-release
+		return nil, nil
+	}
+	s := New(remediate, "secret", zap.NewNop())
+	handler := s.Handler(context.Background())
+	_, started := s.start(context.Background(), types.ObjectRequest{Kind: "Pod", Namespace: "shop", Name: "web-5d9c7"})
+	require.True(t, started)
+
+	// the alert of an object being remediated is not remembered, its next notification triggers a remediation
+	outcomes := postAlerts(t, handler, firing)
+	assert.Equal(t, "the object is already being remediated", outcomes[0].Reason)
+	close(release)
+	s.Wait()
+	outcomes = postAlerts(t, handler, firing)
+	assert.NotEmpty(t, outcomes[0].Job)
+	assert.Empty(t, outcomes[0].Reason)
+	s.Wait()
+}
+
+func TestLabelsFingerprint(t *testing.T) {
+	a := labelsFingerprint(map[string]string{"alertname": "A", "pod": "web"})
+	assert.Equal(t, a, labelsFingerprint(map[string]string{"pod": "web", "alertname": "A"}))
+	assert.NotEqual(t, a, labelsFingerprint(map[string]string{"alertname": "A", "pod": "api"}))
+}
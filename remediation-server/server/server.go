@@ -0,0 +1,300 @@
+// Package server implements the api of the server mode. A remediation takes far longer than any HTTP timeout, so
+// the requests start a job running the remediation pipeline in the background and return its id, the job is then
+// polled on its status endpoint. Alertmanager can post its alerts to /alertmanager as a webhook receiver. Every
+// endpoint but /healthz requires the bearer token.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VedRatan/remediation-server/handlers"
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/types"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// jobRetention is how long a finished job can be polled
+const jobRetention = time.Hour
+
+// alertRetention is how long a firing alert is remembered after its last notification, when its resolved
+// notification never comes. It is well above the repeat interval of Alertmanager, 4h by default, which refreshes it.
+const alertRetention = 24 * time.Hour
+
+// maxRequestSize is the largest request body accepted
+const maxRequestSize = 1 << 20
+
+// kinds are the kinds of objects that can be remediated, a workload is remediated through its faulty pod
+var kinds = []string{"Pod", "Deployment", "StatefulSet", "DaemonSet"}
+
+// JobState is the state of a job
+type JobState string
+
+const (
+	JobRunning   JobState = "Running"
+	JobSucceeded JobState = "Succeeded"
+	JobFailed    JobState = "Failed"
+)
+
+// Job is a remediation requested through the api
+type Job struct {
+	ID     string   `json:"id"`
+	State  JobState `json:"state"`
+	Kind   string   `json:"kind"`
+	Target string   `json:"target"`
+	// Record is the namespace/name of the Remediation record and Phase its final phase
+	Record  string        `json:"record,omitempty"`
+	Phase   records.Phase `json:"phase,omitempty"`
+	Message string        `json:"message,omitempty"`
+	// Created and Finished are the start and completion times of the job
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// Remediator runs the remediation pipeline for the object of the request, started is called with the namespace/name
+// of the remediation record once it is created. The finished record is returned, nil if the object needed no
+// remediation.
+type Remediator func(ctx context.Context, request types.ObjectRequest, source string, started func(record string)) (*records.Remediation, error)
+
+// Request is the body of POST /remediations: either an Alert, whose target is the pod of its remediationYAML, or
+// a reference to the object along with the problem
+type Request struct {
+	types.Alert
+	types.ObjectRequest
+}
+
+// Server runs the remediation jobs requested through the api
+type Server struct {
+	remediate Remediator
+	token     string
+	logger    *zap.Logger
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	// active maps the kind/namespace/name of the objects being remediated to their job, an object is only
+	// remediated by one job at a time
+	active map[string]string
+	// alerts maps the fingerprints of the firing alerts which triggered a job to the time they are forgotten at
+	alerts map[string]time.Time
+	wg     wait.Group
+}
+
+func New(remediate Remediator, token string, logger *zap.Logger) *Server {
+	return &Server{
+		remediate: remediate,
+		token:     token,
+		logger:    logger,
+		jobs:      map[string]*Job{},
+		active:    map[string]string{},
+		alerts:    map[string]time.Time{},
+	}
+}
+
+// Handler returns the routes of the api, the jobs run with the given context
+func (s *Server) Handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("POST /remediations", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		s.createJob(ctx, w, r)
+	}))
+	mux.Handle("GET /remediations/{id}", s.authenticated(s.getJob))
+	mux.Handle("POST /alertmanager", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		s.receiveAlerts(ctx, w, r)
+	}))
+	return mux
+}
+
+// Wait blocks until the running jobs are done, they stop once the context of the handler is cancelled
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// Serve serves the api on addr until the context is cancelled, and waits for the running jobs
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s.Handler(ctx), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx) //nolint:contextcheck
+	}()
+	s.logger.Info("serving the remediation api", zap.String("addr", addr))
+	err := server.ListenAndServe()
+	s.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) authenticated(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) createJob(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var request Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse the request: %v", err), http.StatusBadRequest)
+		return
+	}
+	objectRequest, err := toObjectRequest(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	job, started := s.start(ctx, objectRequest)
+	if !started {
+		writeJSON(w, http.StatusConflict, job)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// start starts a job remediating the object of the request and returns it. If the object is already being
+// remediated the running job is returned instead, and started is false.
+func (s *Server) start(ctx context.Context, objectRequest types.ObjectRequest) (job Job, started bool) {
+	target := objectRequest.Kind + "/" + objectRequest.Namespace + "/" + objectRequest.Name
+	s.mu.Lock()
+	s.prune(time.Now())
+	if id, ok := s.active[target]; ok {
+		existing := *s.jobs[id]
+		s.mu.Unlock()
+		return existing, false
+	}
+	running := &Job{
+		ID:      string(uuid.NewUUID()),
+		State:   JobRunning,
+		Kind:    objectRequest.Kind,
+		Target:  objectRequest.Namespace + "/" + objectRequest.Name,
+		Created: time.Now(),
+	}
+	s.jobs[running.ID] = running
+	s.active[target] = running.ID
+	job = *running
+	s.mu.Unlock()
+
+	s.logger.Info("remediation requested", zap.String("job", job.ID), zap.String("target", target))
+	s.wg.StartWithContext(ctx, func(ctx context.Context) {
+		s.run(ctx, job.ID, objectRequest)
+	})
+	return job, true
+}
+
+// run runs the remediation pipeline of the job and records its outcome
+func (s *Server) run(ctx context.Context, id string, request types.ObjectRequest) {
+	record, err := s.remediate(ctx, request, "api/"+id, func(record string) {
+		s.update(id, func(job *Job) { job.Record = record })
+	})
+	s.update(id, func(job *Job) {
+		now := time.Now()
+		job.Finished = &now
+		delete(s.active, job.Kind+"/"+job.Target)
+		switch {
+		case err != nil:
+			job.State, job.Message = JobFailed, err.Error()
+		case record == nil:
+			job.State, job.Message = JobSucceeded, "the object is Ready, there is nothing to remediate"
+		default:
+			job.Phase, job.Message = record.Status.Phase, record.Status.Message
+			job.State = JobFailed
+			if record.Status.Phase == records.PhaseSucceeded {
+				job.State = JobSucceeded
+			}
+		}
+		s.logger.Info("remediation job finished", zap.String("job", id), zap.String("target", job.Target), zap.String("state", string(job.State)),
+			zap.String("message", job.Message))
+	})
+}
+
+func (s *Server) update(id string, change func(job *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		change(job)
+	}
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	var response Job
+	if ok {
+		response = *job
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// prune drops the jobs finished for longer than jobRetention and the alerts expired, the caller holds the lock
+func (s *Server) prune(now time.Time) {
+	for id, job := range s.jobs {
+		if job.Finished != nil && now.Sub(*job.Finished) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+	for fingerprint, expires := range s.alerts {
+		if now.After(expires) {
+			delete(s.alerts, fingerprint)
+		}
+	}
+}
+
+// toObjectRequest validates the request, the target of an Alert is the pod of its remediationYAML and the
+// suggested manifest is handed to the model along with the description
+func toObjectRequest(request Request) (types.ObjectRequest, error) {
+	objectRequest := request.ObjectRequest
+	if objectRequest.Name == "" && request.RemediationYAML != "" {
+		name, namespace, err := handlers.ExtractPodDetails(request.RemediationYAML)
+		if err != nil {
+			return objectRequest, err
+		}
+		objectRequest = types.ObjectRequest{
+			Kind:      "Pod",
+			Namespace: namespace,
+			Name:      name,
+			Problem:   fmt.Sprintf("%s\n\nThe alert suggested the following manifest:\n%s", request.Description, request.RemediationYAML),
+		}
+	}
+	if objectRequest.Kind == "" {
+		objectRequest.Kind = "Pod"
+	}
+	switch {
+	case objectRequest.Namespace == "" || objectRequest.Name == "":
+		return objectRequest, fmt.Errorf("the request must name the object by namespace and name, or carry a remediationYAML")
+	case !slices.Contains(kinds, objectRequest.Kind):
+		return objectRequest, fmt.Errorf("only %s can be remediated, got the kind %q", strings.Join(kinds, ", "), objectRequest.Kind)
+	case strings.TrimSpace(objectRequest.Problem) == "":
+		return objectRequest, fmt.Errorf("the request must describe the problem of the object")
+	}
+	return objectRequest, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
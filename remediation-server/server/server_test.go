@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VedRatan/remediation-server/records"
+	"github.com/VedRatan/remediation-server/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func do(t *testing.T, handler http.Handler, method, path, token, body string) (*httptest.ResponseRecorder, Job) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var job Job
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	}
+	return rec, job
+}
+
+func TestServer(t *testing.T) {
+	release := make(chan struct{})
+	var got types.ObjectRequest
+	remediate := func(ctx context.Context, request types.ObjectRequest, source string, started func(string)) (*records.Remediation, error) {
+		got = request
+		started("default/web-abcde")
+		<-release
+		record := &records.Remediation{}
+		record.Status.Phase, record.Status.Message = records.PhaseSucceeded, "pod remediated and in Ready state"
+		return record, nil
+	}
+	s := New(remediate, "secret", zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := s.Handler(ctx)
+
+	rec, _ := do(t, handler, http.MethodGet, "/healthz", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec, _ = do(t, handler, http.MethodPost, "/remediations", "wrong", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec, _ = do(t, handler, http.MethodPost, "/remediations", "secret", `{"namespace": "default", "name": "web"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, "the problem is required")
+	rec, _ = do(t, handler, http.MethodPost, "/remediations", "secret", `{"kind": "Node", "namespace": "default", "name": "web", "problem": "down"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec, job := do(t, handler, http.MethodPost, "/remediations", "secret", `{"namespace": "default", "name": "web", "problem": "crash looping"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, JobRunning, job.State)
+	assert.Equal(t, "default/web", job.Target)
+
+	rec, conflict := do(t, handler, http.MethodPost, "/remediations", "secret", `{"namespace": "default", "name": "web", "problem": "crash looping"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code, "the target is already being remediated")
+	assert.Equal(t, job.ID, conflict.ID)
+
+	close(release)
+	s.Wait()
+	assert.Equal(t, types.ObjectRequest{Kind: "Pod", Namespace: "default", Name: "web", Problem: "crash looping"}, got)
+
+	rec, job = do(t, handler, http.MethodGet, "/remediations/"+job.ID, "secret", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, JobSucceeded, job.State)
+	assert.Equal(t, records.PhaseSucceeded, job.Phase)
+	assert.Equal(t, "default/web-abcde", job.Record)
+	assert.NotNil(t, job.Finished)
+
+	rec, _ = do(t, handler, http.MethodGet, "/remediations/unknown", "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// finished jobs are dropped after the retention
+	s.prune(time.Now().Add(2 * jobRetention))
+	rec, _ = do(t, handler, http.MethodGet, "/remediations/"+job.ID, "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestToObjectRequest(t *testing.T) {
+	request, err := toObjectRequest(Request{Alert: types.Alert{
+		Description:     "OOMKilled",
+		RemediationYAML: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n  namespace: shop\n",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "Pod", request.Kind)
+	assert.Equal(t, "shop", request.Namespace)
+	assert.Equal(t, "web", request.Name)
+	assert.Contains(t, request.Problem, "OOMKilled\n\nThe alert suggested the following manifest:\napiVersion: v1")
+
+	_, err = toObjectRequest(Request{})
+	assert.ErrorContains(t, err, "must name the object")
+}
@@ -0,0 +1,18 @@
+package types
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a single turn of the conversation with an ai backend
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Reply is the answer of an ai backend along with the tokens spent on the request
+type Reply struct {
+	Content string
+	Tokens  int
+}
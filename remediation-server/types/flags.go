@@ -0,0 +1,101 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DurationMap is a flag holding a duration per kind, ex: Pod=5m,Deployment=10m. The "*" key is used for the
+// kinds that are not listed.
+type DurationMap map[string]time.Duration
+
+func (m DurationMap) String() string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, m[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m DurationMap) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected Kind=duration, got %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid duration for %s: %v", key, err)
+		}
+		m[strings.ToLower(strings.TrimSpace(key))] = d
+	}
+	return nil
+}
+
+// For returns the duration configured for the kind
+func (m DurationMap) For(kind string) time.Duration {
+	if d, ok := m[strings.ToLower(kind)]; ok {
+		return d
+	}
+	return m["*"]
+}
+
+// StringSlice is a flag that can be repeated, every occurrence appends its value
+type StringSlice []string
+
+func (s *StringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// WeightMap is a flag holding a weight per key, ex: spec.containers[*].image=3,spec.containers[*].command=5.
+// The listed keys are merged into the defaults.
+type WeightMap map[string]float64
+
+func (m WeightMap) String() string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%g", key, m[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m WeightMap) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected key=weight, got %q", pair)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || w < 0 {
+			return fmt.Errorf("invalid weight for %s: %q", key, raw)
+		}
+		m[strings.TrimSpace(key)] = w
+	}
+	return nil
+}
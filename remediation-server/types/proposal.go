@@ -0,0 +1,105 @@
+package types
+
+// Proposal is the structured answer the ai backends are asked to return for a faulty object
+type Proposal struct {
+	// Actions is the typed remediation plan, it is validated and executed by the remediation-server
+	Actions []Action `json:"actions"`
+	// Manifest is the remediated pod manifest. It is rendered from the pod actions, replies of models that
+	// ignore the JSON contract may carry it directly.
+	Manifest      string   `json:"manifest,omitempty"`
+	Explanation   string   `json:"explanation"`
+	Confidence    float64  `json:"confidence"`
+	ChangedFields []string `json:"changedFields,omitempty"`
+}
+
+// Action is a single step of a remediation plan, only the fields of its type are set
+type Action struct {
+	// Type is one of setImage, setEnv, setResources, setProbe, rollbackToRevision, scale and restart
+	Type string `json:"type"`
+	// Container is the container changed by the pod actions
+	Container string `json:"container,omitempty"`
+	// Image is the new image of setImage
+	Image string `json:"image,omitempty"`
+	// Name and Value are the environment variable of setEnv, an empty value removes it
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+	// CPURequest, MemoryRequest, CPULimit and MemoryLimit are the quantities of setResources, ex: 250m or 512Mi
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+	// Probe is the probe replaced by setProbe: liveness, readiness or startup. It checks HTTPPath on Port if set,
+	// Command if set, or else opens a TCP connection to Port.
+	Probe               string   `json:"probe,omitempty"`
+	HTTPPath            string   `json:"httpPath,omitempty"`
+	Port                int32    `json:"port,omitempty"`
+	Command             []string `json:"command,omitempty"`
+	InitialDelaySeconds int32    `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int32    `json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int32    `json:"timeoutSeconds,omitempty"`
+	FailureThreshold    int32    `json:"failureThreshold,omitempty"`
+	// Revision is the Deployment revision of rollbackToRevision
+	Revision int64 `json:"revision,omitempty"`
+	// Replicas is the replica count of scale
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+func stringProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func integerProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "description": description}
+}
+
+// ActionSchema is the JSON schema of Action
+var ActionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"type": map[string]interface{}{
+			"type":        "string",
+			"description": "The action to take",
+			"enum":        []string{"setImage", "setEnv", "setResources", "setProbe", "rollbackToRevision", "scale", "restart"},
+		},
+		"container":           stringProperty("Container changed by setImage, setEnv, setResources and setProbe"),
+		"image":               stringProperty("New image of setImage"),
+		"name":                stringProperty("Name of the environment variable of setEnv"),
+		"value":               stringProperty("Value of the environment variable of setEnv, empty to remove it"),
+		"cpuRequest":          stringProperty("CPU request of setResources, ex: 250m"),
+		"memoryRequest":       stringProperty("Memory request of setResources, ex: 256Mi"),
+		"cpuLimit":            stringProperty("CPU limit of setResources, ex: 500m"),
+		"memoryLimit":         stringProperty("Memory limit of setResources, ex: 512Mi"),
+		"probe":               stringProperty("Probe replaced by setProbe: liveness, readiness or startup"),
+		"httpPath":            stringProperty("HTTP path checked by the probe of setProbe"),
+		"port":                integerProperty("Port checked by the probe of setProbe"),
+		"command":             map[string]interface{}{"type": "array", "description": "Command run by the probe of setProbe", "items": map[string]interface{}{"type": "string"}},
+		"initialDelaySeconds": integerProperty("Initial delay of the probe of setProbe"),
+		"periodSeconds":       integerProperty("Period of the probe of setProbe"),
+		"timeoutSeconds":      integerProperty("Timeout of the probe of setProbe"),
+		"failureThreshold":    integerProperty("Failure threshold of the probe of setProbe"),
+		"revision":            integerProperty("Deployment revision of rollbackToRevision"),
+		"replicas":            integerProperty("Replica count of scale"),
+	},
+	"required": []string{"type"},
+}
+
+// ProposalSchema is the JSON schema of Proposal, handed to the ai backends that support structured output
+var ProposalSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"actions": map[string]interface{}{
+			"type":        "array",
+			"description": "The remediation plan, applied in order",
+			"items":       ActionSchema,
+		},
+		"explanation": map[string]interface{}{
+			"type":        "string",
+			"description": "Short explanation of the root cause and of the fix",
+		},
+		"confidence": map[string]interface{}{
+			"type":        "number",
+			"description": "Confidence that the fix resolves the problem, between 0 and 1",
+		},
+	},
+	"required": []string{"actions", "explanation", "confidence"},
+}
@@ -1,13 +1,67 @@
 package types
 
-import "go.uber.org/zap"
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
 
 var (
-	K8sAgentServiceURL string // Flag to store the k8s-agent-service LoadBalancer IP
-	AiAgent            string // Flag to use the Ai Agent { Gemini, Cohere, Deepseek etc. }
-	AiAgentKey         string // Flag to store the Ai Agent ApiKey
-	Insecure           bool   // Flag to tell remediation server that the k8s-agent-service is hosted with https:// (i.e, using tls) or http:// (i.e, not using tls).
-	Logger             *zap.Logger
+	K8sAgentServiceURL     string        // Flag to store the k8s-agent-service LoadBalancer IP
+	AiAgent                string        // Flag to use the Ai Agent { Gemini, OpenAI, Ollama etc. }, a comma separated list is used as an ordered fallback chain
+	AiAgentKey             string        // Flag to store the Ai Agent ApiKey
+	OpenAIKey              string        // Flag to store the OpenAI ApiKey
+	OpenAIModel            string        // Flag to store the OpenAI model to use
+	OllamaURL              string        // Flag to store the base url of the Ollama server
+	OllamaModel            string        // Flag to store the Ollama model to use
+	AiFailureThreshold     int           // Flag to store the consecutive failures after which an ai backend is skipped
+	AiCooldown             time.Duration // Flag to store how long a failing ai backend is skipped
+	MaxConcurrentAiCalls   int           // Flag to store how many ai calls run at once across the workers, 0 means unlimited
+	MaxRepairAttempts      int           // Flag to store how many times the ai backend is asked for a valid remediation of a single proposal
+	MaxAttemptsPerResult   int           // Flag to store how many times the ai backend is asked for a remediation of a single Result, across its fix iterations and retries
+	MaxTokensPerResult     int           // Flag to store the token budget of the repair loop of a single Result, 0 means unlimited
+	MaxFixIterations       int           // Flag to store how many fixes are applied before the original object is rolled back and the remediation escalated
+	PromptLogBudget        int           // Flag to store the size in bytes of the logs of a single container in the prompt
+	PromptEventsBudget     int           // Flag to store the size in bytes of the events in the prompt
+	Redact                 bool          // Flag to store whether secrets are masked before the prompt is sent to the ai backend
+	RedactAnnotations      string        // Flag to store the comma separated annotation keys whose values are masked
+	RedactEntropy          float64       // Flag to store the entropy above which a token is masked as a secret, 0 disables the check
+	RedactPatterns         StringSlice   // Flag to store custom regexes to mask
+	PromptConfigMap        string        // Flag to store the namespace/name of the ConfigMap holding the prompt templates
+	AllowedChanges         string        // Flag to store the comma separated paths a remediation is allowed to change
+	DisallowedChanges      string        // Flag to store whether a remediation with disallowed changes is rejected or pruned
+	AllowedActions         string        // Flag to store the comma separated action types the remediation plans may use
+	SandboxNamespace       string        // Flag to store the namespace the remediated pods are tried in as shadow pods first, empty disables the sandbox
+	SandboxNetworkPolicy   bool          // Flag to store whether the shadow pods are isolated by a deny-all NetworkPolicy
+	SandboxSkipVolumes     bool          // Flag to store whether the remediations of pods with persistent volumes are applied without the sandbox
+	RiskAutoApplyBelow     float64       // Flag to store the risk score below which a remediation is applied without approval
+	RiskRefuseAbove        float64       // Flag to store the risk score above which a remediation is refused
+	ApprovalTimeout        time.Duration // Flag to store how long a remediation waits for its approval
+	RemediationCooldown    time.Duration // Flag to store how long an object is not remediated again after a remediation
+	Workers                int           // Flag to store the number of workers remediating concurrently
+	NotifyWebhook          string        // Flag to store the url the notifications are posted to
+	MetricsAddr            string        // Flag to store the address the metrics are served on
+	WatchResults           bool          // Flag to store whether the k8sgpt Results are watched, disabled when the k8sgpt operator is not installed
+	DetectEvents           bool          // Flag to store whether the faulty pods are detected from their Warning events and status transitions
+	DetectDebounce         time.Duration // Flag to store how long the detector waits for more events of a pod before it is remediated
+	DetectIgnoreNamespaces string        // Flag to store the comma separated namespaces the detector and the analyzers ignore
+	AnalyzeInterval        time.Duration // Flag to store how often the built-in analyzers run, 0 disables them
+	Analyzers              string        // Flag to store the comma separated built-in analyzers to run
+	LeaderElect            bool          // Flag to store whether the replicas elect a leader through a Lease, only the leader remediates
+	LeaderElectionID       string        // Flag to store the name of the Lease of the leader election
+	LeaderElectionNS       string        // Flag to store the namespace of the Lease of the leader election
+	LeaseDuration          time.Duration // Flag to store how long the Lease of a leader that stopped renewing it is kept before another replica takes over
+	ServerAddr             string        // Flag to store the address the api of the server mode is served on
+	ServerToken            string        // Flag to store the bearer token required by the api of the server mode
+	Insecure               bool          // Flag to tell remediation server that the k8s-agent-service is hosted with https:// (i.e, using tls) or http:// (i.e, not using tls).
+	Logger                 *zap.Logger
+)
+
+var (
+	VerifyTimeouts       = DurationMap{"pod": 5 * time.Minute, "*": 10 * time.Minute} // Flag to store how long the remediated object is given to become Ready, per kind
+	VerifyStability      = DurationMap{"pod": 15 * time.Second, "*": 0}               // Flag to store how long the remediated object has to stay Ready before it is considered healthy, per kind
+	RiskPathWeights      = WeightMap{}                                                // Flag to store the risk weight of the changes per path, merged into policy.DefaultPathWeights
+	RiskNamespaceWeights = WeightMap{"kube-system": 3, "*": 1}                        // Flag to store the multiplier of the risk score per namespace
 )
 
 // Alert struct with the expected parameters
@@ -15,3 +69,12 @@ type Alert struct {
 	Description     string `json:"description"`
 	RemediationYAML string `json:"remediationYAML"`
 }
+
+// ObjectRequest asks the server mode for the remediation of an object
+type ObjectRequest struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Problem describes what is wrong with the object, it takes the place of the details of a k8sgpt Result
+	Problem string `json:"problem"`
+}
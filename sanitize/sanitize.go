@@ -0,0 +1,66 @@
+// Package sanitize turns live objects into their desired state, it is shared by the remediation-server, which
+// prompts the ai backend with clean manifests, and the k8s-agent, which creates the remediated objects.
+package sanitize
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// serviceAccountVolumePrefix is the prefix of the projected token volume injected by the ServiceAccount admission
+// plugin, it is injected again when the pod is created
+const serviceAccountVolumePrefix = "kube-api-access-"
+
+// Pod returns a copy of the pod without the fields managed by the api server, the scheduler and the kubelet.
+func Pod(pod *corev1.Pod) *corev1.Pod {
+	pod = pod.DeepCopy()
+	Meta(&pod.ObjectMeta)
+	pod.Status = corev1.PodStatus{}
+	pod.Spec.NodeName = ""
+	pod.Spec.EphemeralContainers = nil
+
+	var volumes []corev1.Volume
+	for _, volume := range pod.Spec.Volumes {
+		if !strings.HasPrefix(volume.Name, serviceAccountVolumePrefix) {
+			volumes = append(volumes, volume)
+		}
+	}
+	pod.Spec.Volumes = volumes
+	stripMounts := func(containers []corev1.Container) {
+		for i := range containers {
+			var mounts []corev1.VolumeMount
+			for _, mount := range containers[i].VolumeMounts {
+				if !strings.HasPrefix(mount.Name, serviceAccountVolumePrefix) {
+					mounts = append(mounts, mount)
+				}
+			}
+			containers[i].VolumeMounts = mounts
+		}
+	}
+	stripMounts(pod.Spec.InitContainers)
+	stripMounts(pod.Spec.Containers)
+	return pod
+}
+
+// Meta clears the server-managed metadata in place.
+func Meta(meta *metav1.ObjectMeta) {
+	meta.UID = ""
+	meta.ResourceVersion = ""
+	meta.Generation = 0
+	meta.CreationTimestamp = metav1.Time{}
+	meta.DeletionTimestamp = nil
+	meta.DeletionGracePeriodSeconds = nil
+	meta.ManagedFields = nil
+	meta.SelfLink = "" //nolint:staticcheck
+}
+
+// Unstructured clears the server-managed metadata and the status of any object in place.
+func Unstructured(obj *unstructured.Unstructured) {
+	for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "managedFields", "selfLink"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+}
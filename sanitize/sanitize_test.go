@@ -0,0 +1,67 @@
+package sanitize
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPod(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app",
+			Namespace:         "default",
+			UID:               "1234",
+			ResourceVersion:   "42",
+			CreationTimestamp: metav1.Now(),
+			ManagedFields:     []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+			Labels:            map[string]string{"app": "app"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Volumes:  []corev1.Volume{{Name: "data"}, {Name: "kube-api-access-x7k2p"}},
+			Containers: []corev1.Container{{
+				Name:         "app",
+				VolumeMounts: []corev1.VolumeMount{{Name: "data"}, {Name: "kube-api-access-x7k2p"}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	clean := Pod(pod)
+	if clean.UID != "" || clean.ResourceVersion != "" || !clean.CreationTimestamp.IsZero() || clean.ManagedFields != nil {
+		t.Errorf("server-managed metadata was not stripped: %+v", clean.ObjectMeta)
+	}
+	if clean.Name != "app" || clean.Namespace != "default" || clean.Labels["app"] != "app" {
+		t.Errorf("desired metadata was stripped: %+v", clean.ObjectMeta)
+	}
+	if clean.Spec.NodeName != "" || clean.Status.Phase != "" {
+		t.Errorf("nodeName or status was not stripped")
+	}
+	if len(clean.Spec.Volumes) != 1 || len(clean.Spec.Containers[0].VolumeMounts) != 1 {
+		t.Errorf("service account token volume was not stripped: %+v", clean.Spec.Volumes)
+	}
+	if pod.UID == "" || pod.Spec.NodeName == "" {
+		t.Errorf("the original pod must not be modified")
+	}
+}
+
+func TestUnstructured(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "app", "uid": "1234", "resourceVersion": "42", "managedFields": []interface{}{}},
+		"spec":     map[string]interface{}{"replicas": int64(2)},
+		"status":   map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+	Unstructured(obj)
+	if obj.GetUID() != "" || obj.GetResourceVersion() != "" || obj.GetManagedFields() != nil {
+		t.Errorf("server-managed metadata was not stripped: %v", obj.Object["metadata"])
+	}
+	if _, ok := obj.Object["status"]; ok {
+		t.Errorf("status was not stripped")
+	}
+	if obj.GetName() != "app" {
+		t.Errorf("name was stripped")
+	}
+}